@@ -2,50 +2,30 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
 	"os"
 	"qga-example/generated/qapi"
 
-	"github.com/q-controller/qapi-client/src/client"
 	"github.com/q-controller/qapi-client/src/monitor"
 	"github.com/spf13/cobra"
 )
 
 var socketPath string
 
-type ShutdownProcessor struct {
-	qapi.DefaultEventProcessor
-	shutdown bool
-}
-
-func (ep *ShutdownProcessor) ProcessSHUTDOWN(arg qapi.QObjSHUTDOWNArg) error {
-	slog.Info("Processing event", "event", "SHUTDOWN", "data", arg)
-	ep.shutdown = true
-	return nil
-}
-
-type Greeting struct {
-	QMP struct {
-		Version      qapi.VersionInfo       `json:"version"`
-		Capabilities qapi.QMPCapabilityList `json:"capabilities"`
-	} `json:"QMP"`
-}
-
 var rootCmd = &cobra.Command{
 	Use:   "qga-example",
 	Short: "A brief description of your application",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		monitor, monitorErr := monitor.NewMonitor()
-		if monitorErr != nil {
-			return monitorErr
+		mon, monErr := monitor.NewMonitor()
+		if monErr != nil {
+			return monErr
 		}
 
-		defer monitor.Close()
-		msgCh := monitor.Messages()
+		defer mon.Close()
 
+		// Add resolves once the greeting is received and capabilities are negotiated
 		for {
-			addFut := monitor.Add("example instance", socketPath)
+			addFut := mon.Add("example instance", socketPath)
 			if err, ok := <-addFut; !ok || err != nil {
 				slog.Error("Could not add instance", "error", err)
 				continue
@@ -53,58 +33,29 @@ var rootCmd = &cobra.Command{
 			break
 		}
 
-		ep := ShutdownProcessor{}
-		for data := range msgCh {
-			msg := data.Message
-			if msg == nil {
-				continue
-			}
-			if msg.Event != nil {
-				qapi.ProcessEvent(&ep, msg.Event.Event, msg.Event.Data)
-				if ep.shutdown {
-					break
-				}
-			}
+		if greeting, ok := mon.Greeting("example instance"); ok {
+			slog.Info("Connected to the instance", "version", greeting.QMP.Version.Qemu)
+		}
 
-			if msg.Generic != nil {
-				var greeting Greeting
-				if err := json.Unmarshal(msg.Generic, &greeting); err == nil {
-					if req, reqErr := qapi.PrepareQmpCapabilitiesRequest(qapi.QObjQmpCapabilitiesArg{}); reqErr == nil {
-						if ch, chErr := monitor.Execute("example instance", client.Request(*req)); chErr == nil {
-							res, ok := ch.Get(context.Background(), -1)
-							if !ok {
-								continue
-							}
-							if res.Error == nil {
-								if schemaReq, schemaErr := qapi.PrepareQueryStatusRequest(); schemaErr == nil {
-									if statusCh, statusChErr := monitor.Execute("example instance", client.Request(*schemaReq)); statusChErr == nil {
-										status, ok := statusCh.Get(context.Background(), -1)
-										if !ok {
-											continue
-										}
-										if status.Return != nil {
-											var statusInfo qapi.StatusInfo
-											if unmarshalErr := json.Unmarshal(status.Return, &statusInfo); unmarshalErr == nil {
-												slog.Info("Retrieved status of the instance", "status", statusInfo.Status)
-												if shReq, shReqErr := qapi.PrepareSystemPowerdownRequest(); shReqErr == nil {
-													if shutdownCh, shutdownChErr := monitor.Execute("example instance", client.Request(*shReq)); shutdownChErr == nil {
-														_, _ = shutdownCh.Get(context.Background(), -1)
-														slog.Info("Shutdown command sent to the instance")
-													} else {
-														slog.Error("Failed to send shutdown command", "error", shutdownChErr)
-													}
-												} else {
-													slog.Error("Failed to prepare shutdown request", "error", shReqErr)
-												}
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
+		if statusInfo, statusErr := qapi.ExecQueryStatus(context.Background(), mon, "example instance"); statusErr == nil {
+			slog.Info("Retrieved status of the instance", "status", statusInfo.Status)
+		} else {
+			slog.Error("Failed to query status", "error", statusErr)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// Subscribe before powering down, so the event cannot be missed
+		shutdowns := qapi.OnSHUTDOWN(ctx, mon, "example instance")
+
+		if shutdownErr := qapi.ExecSystemPowerdown(context.Background(), mon, "example instance"); shutdownErr == nil {
+			slog.Info("Shutdown command sent to the instance")
+		} else {
+			slog.Error("Failed to send shutdown command", "error", shutdownErr)
+		}
+
+		if shutdown, ok := <-shutdowns; ok {
+			slog.Info("Instance shut down", "time", shutdown.Time, "guest", shutdown.Data.Guest, "reason", shutdown.Data.Reason)
 		}
 
 		return nil
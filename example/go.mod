@@ -5,7 +5,6 @@ go 1.25.10
 replace github.com/q-controller/qapi-client v0.0.0 => ../
 
 require (
-	github.com/google/uuid v1.6.0
 	github.com/q-controller/qapi-client v0.0.0
 	github.com/spf13/cobra v1.10.2
 )
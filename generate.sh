@@ -15,31 +15,33 @@ cleanup() {
 
 usage() {
 	cat <<EOF
-Usage: $(basename "${BASH_SOURCE[0]}") [-h] [-v] --schema PATH --out-dir PATH --package PKG
+Usage: $(basename "${BASH_SOURCE[0]}") [-h] [-v] --schema PATH --package PKG [--schema PATH --package PKG ...] --out-dir PATH
 
-Processes qapi schema and generates go code.
+Processes qapi schemas and generates go code, one package per schema.
 
 Available options:
 
 -h, --help            Print this help and exit
 -v, --verbose         Print script debug info
---schema              Path to qapi schema
+--schema              Path to qapi schema, may be repeated
 --out-dir             Path to an output folder
---package             Package name
+--package             Package name for the preceding --schema
+--compat              Compat policy like QEMU's -compat, e.g. deprecated-input=reject,deprecated-output=hide
 EOF
 	exit
 }
 
-SCHEMA=""
+SCHEMAS=()
 OUTDIR=""
-PACKAGE=""
+PACKAGES=()
+COMPAT=""
 parse_params() {
 	while :; do
 		case "${1-}" in
 		-h | --help) usage ;;
 		-v | --verbose) set -x ;;
 		--schema)
-        SCHEMA="${2-}"
+        SCHEMAS+=("${2-}")
         shift
         ;;
 		--out-dir)
@@ -50,7 +52,11 @@ parse_params() {
         shift
         ;;
 		--package)
-        PACKAGE="${2-}"
+        PACKAGES+=("${2-}")
+        shift
+        ;;
+		--compat)
+        COMPAT="${2-}"
         shift
         ;;
 		-?*) echo "Unknown option: $1" && exit 1 ;;
@@ -60,9 +66,10 @@ parse_params() {
 	done
 
 	args=("$@")
-    [ -z "${SCHEMA}" ] && echo "Missing parameter: --schema" && exit 1
+    [ ${#SCHEMAS[@]} -eq 0 ] && echo "Missing parameter: --schema" && exit 1
     [ -z "${OUTDIR}" ] && echo "Missing parameter: --out-dir" && exit 1
-    [ -z "${PACKAGE}" ] && echo "Missing parameter: --package" && exit 1
+    [ ${#PACKAGES[@]} -eq 0 ] && echo "Missing parameter: --package" && exit 1
+    [ ${#SCHEMAS[@]} -ne ${#PACKAGES[@]} ] && echo "Every --schema needs a --package" && exit 1
 
 	return 0
 }
@@ -75,4 +82,7 @@ python3 -m venv ${script_dir}/.venv
 source ${script_dir}/.venv/bin/activate
 python3 -m pip install jinja2 >/dev/null 2>&1
 
-PYTHONPATH=${script_dir}/src/generator python3 ${script_dir}/qemu/scripts/qapi-gen.py -o ${OUTDIR} ${SCHEMA} --backend gobackend.QAPIGoBackend --prefix ${PACKAGE} >/dev/null
+export QAPI_GO_COMPAT="${COMPAT}"
+for i in "${!SCHEMAS[@]}"; do
+    PYTHONPATH=${script_dir}/src/generator python3 ${script_dir}/qemu/scripts/qapi-gen.py -o ${OUTDIR} ${SCHEMAS[$i]} --backend gobackend.QAPIGoBackend --prefix ${PACKAGES[$i]} >/dev/null
+done
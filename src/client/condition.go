@@ -0,0 +1,38 @@
+package client
+
+// Condition is the 'if' condition of a QAPI schema entity: the entity only exists
+// in QEMU builds where it holds. At most one of Name, All, Any and Not is set;
+// Name is a configuration symbol such as CONFIG_SPICE or TARGET_S390X.
+// The zero Condition always holds.
+type Condition struct {
+	Name string
+	All  []Condition
+	Any  []Condition
+	Not  *Condition
+}
+
+// Eval evaluates the condition, defined reports whether a configuration symbol
+// is set in the QEMU build of interest.
+func (c Condition) Eval(defined func(name string) bool) bool {
+	switch {
+	case c.Name != "":
+		return defined(c.Name)
+	case c.Not != nil:
+		return !c.Not.Eval(defined)
+	case len(c.All) > 0:
+		for _, cond := range c.All {
+			if !cond.Eval(defined) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) > 0:
+		for _, cond := range c.Any {
+			if cond.Eval(defined) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package client
+
+import "testing"
+
+func TestConditionEval(t *testing.T) {
+	symbols := map[string]bool{"CONFIG_LINUX": true, "TARGET_S390X": true}
+	defined := func(name string) bool { return symbols[name] }
+
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"unconditional", Condition{}, true},
+		{"defined", Condition{Name: "CONFIG_LINUX"}, true},
+		{"undefined", Condition{Name: "CONFIG_SPICE"}, false},
+		{"not", Condition{Not: &Condition{Name: "CONFIG_SPICE"}}, true},
+		{"all", Condition{All: []Condition{{Name: "CONFIG_LINUX"}, {Name: "TARGET_S390X"}}}, true},
+		{"all with undefined", Condition{All: []Condition{{Name: "CONFIG_LINUX"}, {Name: "CONFIG_SPICE"}}}, false},
+		{"any", Condition{Any: []Condition{{Name: "TARGET_I386"}, {Name: "TARGET_S390X"}}}, true},
+		{"any undefined", Condition{Any: []Condition{{Name: "TARGET_I386"}, {Name: "TARGET_X86_64"}}}, false},
+		{"nested", Condition{All: []Condition{
+			{Name: "CONFIG_LINUX"},
+			{Not: &Condition{Any: []Condition{{Name: "TARGET_I386"}, {Name: "CONFIG_SPICE"}}}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.Eval(defined); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
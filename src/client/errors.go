@@ -0,0 +1,32 @@
+package client
+
+import "fmt"
+
+// Sentinels for the error classes QEMU reports in QMP replies. A reply's *Error
+// matches the sentinel of its class with errors.Is.
+var (
+	ErrGenericError    = &Error{Class: "GenericError"}
+	ErrCommandNotFound = &Error{Class: "CommandNotFound"}
+	ErrDeviceNotActive = &Error{Class: "DeviceNotActive"}
+	ErrDeviceNotFound  = &Error{Class: "DeviceNotFound"}
+	ErrKVMMissingCap   = &Error{Class: "KVMMissingCap"}
+)
+
+// Reasons a request can end without a reply from QEMU.
+var (
+	ErrProtocol        = fmt.Errorf("protocol error")
+	ErrRequestCanceled = fmt.Errorf("request canceled")
+	ErrDisconnected    = fmt.Errorf("instance disconnected")
+	ErrTimeout         = fmt.Errorf("request timed out")
+	ErrQueueFull       = fmt.Errorf("write queue full")
+)
+
+// Is reports whether target is an *Error of the same class. A target without a
+// description matches any description.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Class == e.Class && (t.Description == "" || t.Description == e.Description)
+}
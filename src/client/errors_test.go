@@ -0,0 +1,61 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{
+			name:   "Same class",
+			err:    &Error{Class: "DeviceNotFound", Description: "Device 'foo' not found"},
+			target: ErrDeviceNotFound,
+			want:   true,
+		},
+		{
+			name:   "Different class",
+			err:    &Error{Class: "DeviceNotFound", Description: "Device 'foo' not found"},
+			target: ErrGenericError,
+			want:   false,
+		},
+		{
+			name:   "Wrapped error",
+			err:    fmt.Errorf("blockdev-del: %w", &Error{Class: "GenericError", Description: "Node 'foo' is busy"}),
+			target: ErrGenericError,
+			want:   true,
+		},
+		{
+			name:   "Matching description",
+			err:    &Error{Class: "GenericError", Description: "busy"},
+			target: &Error{Class: "GenericError", Description: "busy"},
+			want:   true,
+		},
+		{
+			name:   "Different description",
+			err:    &Error{Class: "GenericError", Description: "busy"},
+			target: &Error{Class: "GenericError", Description: "idle"},
+			want:   false,
+		},
+		{
+			name:   "Not a QMP error",
+			err:    &Error{Class: "GenericError"},
+			target: ErrDisconnected,
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 )
 
+// Outcome is what an Executor delivers for a request: either QEMU's reply or,
+// when no reply will ever arrive, the reason why.
+type Outcome struct {
+	Result QAPIResult
+	Err    error
+}
+
 type Executor struct {
-	requestLoop *Dispatcher[QAPIResult]
+	requestLoop *Dispatcher[Outcome]
 	instances   map[string]map[string]struct{}
 	instanceCh  chan func()
 }
 
 func NewExecutor() *Executor {
 	executor := &Executor{
-		requestLoop: NewDispatcher[QAPIResult](0),
+		requestLoop: NewDispatcher[Outcome](0),
 		instances:   make(map[string]map[string]struct{}),
 		instanceCh:  make(chan func()),
 	}
@@ -26,7 +33,7 @@ func NewExecutor() *Executor {
 	return executor
 }
 
-func (e *Executor) Enqueue(instance string, requestId string) <-chan QAPIResult {
+func (e *Executor) Enqueue(instance string, requestId string) <-chan Outcome {
 	ch := e.requestLoop.Enqueue(requestId)
 	e.instanceCh <- func() {
 		if e.instances[instance] == nil {
@@ -38,9 +45,18 @@ func (e *Executor) Enqueue(instance string, requestId string) <-chan QAPIResult
 }
 
 func (e *Executor) Complete(requestId string, result QAPIResult) {
-	e.requestLoop.Post(Data[QAPIResult]{
+	e.finish(requestId, Outcome{Result: result})
+}
+
+// CancelRequest completes a single request with err instead of a reply.
+func (e *Executor) CancelRequest(requestId string, err error) {
+	e.finish(requestId, Outcome{Err: err})
+}
+
+func (e *Executor) finish(requestId string, outcome Outcome) {
+	e.requestLoop.Post(Data[Outcome]{
 		Id:      requestId,
-		Payload: result,
+		Payload: outcome,
 	})
 	e.instanceCh <- func() {
 		for instance, reqSet := range e.instances {
@@ -55,13 +71,14 @@ func (e *Executor) Complete(requestId string, result QAPIResult) {
 	}
 }
 
-func (e *Executor) Cancel(instance string) {
+// Cancel completes every pending request of the instance with err.
+func (e *Executor) Cancel(instance string, err error) {
 	e.instanceCh <- func() {
 		if reqSet, exists := e.instances[instance]; exists {
 			for reqId := range reqSet {
-				e.requestLoop.Post(Data[QAPIResult]{
+				e.requestLoop.Post(Data[Outcome]{
 					Id:      reqId,
-					Payload: QAPIResult{},
+					Payload: Outcome{Err: err},
 				})
 			}
 			delete(e.instances, instance)
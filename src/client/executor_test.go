@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pending returns the number of requests the executor still tracks for instance.
+func pending(e *Executor, instance string) int {
+	count := make(chan int)
+	e.instanceCh <- func() {
+		count <- len(e.instances[instance])
+	}
+	return <-count
+}
+
+func receive(t *testing.T, ch <-chan Outcome) Outcome {
+	t.Helper()
+	select {
+	case outcome, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed without an outcome")
+		}
+		return outcome
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for outcome")
+	}
+	return Outcome{}
+}
+
+func TestExecutorCompletion(t *testing.T) {
+	e := NewExecutor()
+	cancel := e.Run(context.Background())
+	defer cancel()
+
+	completed := e.Enqueue("vm", "1")
+	canceled := e.Enqueue("vm", "2")
+	disconnected := e.Enqueue("vm", "3")
+	if got := pending(e, "vm"); got != 3 {
+		t.Fatalf("pending = %d, want 3", got)
+	}
+
+	e.Complete("1", QAPIResult{Id: "1", Return: []byte("{}")})
+	if outcome := receive(t, completed); outcome.Err != nil || outcome.Result.Id != "1" {
+		t.Errorf("completed outcome = %+v", outcome)
+	}
+
+	e.CancelRequest("2", ErrRequestCanceled)
+	if outcome := receive(t, canceled); !errors.Is(outcome.Err, ErrRequestCanceled) {
+		t.Errorf("canceled outcome = %+v", outcome)
+	}
+	if got := pending(e, "vm"); got != 1 {
+		t.Fatalf("pending = %d, want 1", got)
+	}
+
+	e.Cancel("vm", ErrDisconnected)
+	if outcome := receive(t, disconnected); !errors.Is(outcome.Err, ErrDisconnected) {
+		t.Errorf("disconnected outcome = %+v", outcome)
+	}
+	if got := pending(e, "vm"); got != 0 {
+		t.Fatalf("pending = %d, want 0", got)
+	}
+}
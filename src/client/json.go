@@ -0,0 +1,66 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalMerged encodes each value as a JSON object and merges their members into
+// a single object. Nil values and values encoding to null are skipped. Generated
+// code uses it for QAPI flat unions, whose branch members sit next to the base members.
+func MarshalMerged(values ...any) ([]byte, error) {
+	merged := map[string]json.RawMessage{}
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		data, dataErr := json.Marshal(value)
+		if dataErr != nil {
+			return nil, dataErr
+		}
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil, fmt.Errorf("%T does not encode as a JSON object: %w", value, err)
+		}
+		for key, member := range members {
+			merged[key] = member
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// JSON value kinds reported by JSONKind.
+const (
+	JSONObject  = "object"
+	JSONArray   = "array"
+	JSONString  = "string"
+	JSONNumber  = "number"
+	JSONBoolean = "boolean"
+	JSONNull    = "null"
+)
+
+// JSONKind tells which kind of JSON value data holds by looking at its first token.
+// Generated code uses it to pick the branch of a QAPI alternate. It returns an empty
+// string if data does not start a JSON value.
+func JSONKind(data []byte) string {
+	for _, b := range data {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return JSONObject
+		case '[':
+			return JSONArray
+		case '"':
+			return JSONString
+		case 't', 'f':
+			return JSONBoolean
+		case 'n':
+			return JSONNull
+		case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			return JSONNumber
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package client
+
+import "testing"
+
+func TestMarshalMergedRejectsNonObjects(t *testing.T) {
+	if _, err := MarshalMerged(struct{}{}, "scalar"); err == nil {
+		t.Error("MarshalMerged accepted a non-object value")
+	}
+}
+
+func TestJSONKind(t *testing.T) {
+	tests := map[string]string{
+		` {"a": 1}`: JSONObject,
+		"\n[1, 2]":  JSONArray,
+		`"str"`:     JSONString,
+		`-1.5`:      JSONNumber,
+		`0`:         JSONNumber,
+		`true`:      JSONBoolean,
+		`false`:     JSONBoolean,
+		`null`:      JSONNull,
+		``:          "",
+		`}`:         "",
+	}
+	for input, want := range tests {
+		if got := JSONKind([]byte(input)); got != want {
+			t.Errorf("JSONKind(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
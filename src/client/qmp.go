@@ -1,15 +1,46 @@
 package client
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Null struct{}
 type QEmpty struct{}
 
+// Error is the error member of a failed QMP reply.
 type Error struct {
 	Class       string `json:"class"`
 	Description string `json:"desc"`
 }
 
+func (e *Error) Error() string {
+	return e.Class + ": " + e.Description
+}
+
+// VersionTriple is QEMU's major.minor.micro version.
+type VersionTriple struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Micro int `json:"micro"`
+}
+
+type VersionInfo struct {
+	Qemu    VersionTriple `json:"qemu"`
+	Package string        `json:"package"`
+}
+
+type GreetingInfo struct {
+	Version      VersionInfo `json:"version"`
+	Capabilities []string    `json:"capabilities"`
+}
+
+// Greeting is the banner QEMU sends as soon as a QMP connection is established:
+// {"QMP": {"version": {...}, "capabilities": [...]}}
+type Greeting struct {
+	QMP *GreetingInfo `json:"QMP"`
+}
+
 type QAPIEvent struct {
 	Event     string          `json:"event,omitempty"`
 	Data      json.RawMessage `json:"data"`
@@ -19,6 +50,22 @@ type QAPIEvent struct {
 	} `json:"timestamp"`
 }
 
+// Time returns when QEMU emitted the event, the zero time if the event carries
+// no timestamp.
+func (e *QAPIEvent) Time() time.Time {
+	if e.Timestamp == nil {
+		return time.Time{}
+	}
+	return time.Unix(e.Timestamp.Seconds, e.Timestamp.Microseconds*int64(time.Microsecond))
+}
+
+// TimedEvent is a decoded event of an instance together with its emission time.
+type TimedEvent[T any] struct {
+	Instance string
+	Time     time.Time
+	Data     T
+}
+
 type QAPIResult struct {
 	Id     string          `json:"id,omitempty"`
 	Error  *Error          `json:"error,omitempty"`
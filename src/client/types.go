@@ -2,22 +2,50 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"iter"
+	"os"
+	"os/exec"
+	"time"
 )
 
+// Request is a QMP command. Exactly one of Execute and ExecOOB is set; ExecOOB runs
+// the command out-of-band, which requires the oob capability and an Id.
 type Request struct {
 	Id        string          `json:"id,omitempty"`
-	Execute   string          `json:"execute"`
+	Execute   string          `json:"execute,omitempty"`
+	ExecOOB   string          `json:"exec-oob,omitempty"`
 	Arguments json.RawMessage `json:"arguments,omitempty"`
 }
 
+// SchemaFeature tells which special QAPI features a schema entity carries.
+// Generated packages list them in their Features table.
+type SchemaFeature struct {
+	Deprecated bool
+	Unstable   bool
+}
+
+// GenerateId returns a random identifier suitable for Request.Id.
+func GenerateId() string {
+	return rand.Text()
+}
+
 type Event struct {
 	Id     string
-	Data   []string
+	Data   [][]byte
 	Error  error
 	Action *Action
+	// Connection is the connection a listener accepted, for ActionAccept; Id is
+	// the listener's then
+	Connection *Connection
+}
+
+// Connection is a connection accepted by a listener, to be attached as an instance.
+type Connection struct {
+	Fd     int
+	Remote string
 }
 
 type Action int
@@ -27,6 +55,9 @@ const (
 	ActionCancel
 	ActionClose
 	ActionExecute
+	ActionRemove
+	ActionListen
+	ActionAccept
 )
 
 type CommunicationType int
@@ -34,23 +65,69 @@ type CommunicationType int
 const (
 	UnixDomain CommunicationType = iota
 	Pipe
+	TCP
+	Process
 )
 
 type UnixDomainConfig struct {
 	SocketPath string
 }
 
+// TCPConfig describes a QMP endpoint exposed with -qmp tcp:host:port,server=on.
+// A zero DialTimeout falls back to a default instead of waiting indefinitely.
+type TCPConfig struct {
+	Host        string
+	Port        int
+	DialTimeout time.Duration
+}
+
+// ProcessConfig describes QMP on the stdio of a child process (-qmp stdio). Cmd is
+// started with pipes for its stdin and stdout; Started, if set, is called with the
+// running process before those pipes are attached to the queue.
+type ProcessConfig struct {
+	Cmd     *exec.Cmd
+	Started func(*os.Process)
+}
+
 type CommunicationConfig struct {
 	Type       CommunicationType `json:"type"`
 	UnixDomain *UnixDomainConfig `json:"unix_domain,omitempty"`
+	TCP        *TCPConfig        `json:"tcp,omitempty"`
+	Process    *ProcessConfig    `json:"-"`
 }
 
 var ErrUnknownCommunicationType = fmt.Errorf("unknown communication type")
+var ErrMissingCommunicationConfig = fmt.Errorf("missing communication config")
+
+// CommandExecutor runs a request on an instance and waits for its reply.
+// It is satisfied by monitor.Monitor and used by generated command methods.
+type CommandExecutor interface {
+	ExecuteContext(ctx context.Context, instance string, request Request) (*QAPIResult, error)
+}
 
 type EventQueue interface {
 	Wait(context context.Context) (iter.Seq[*Event], error)
 	Add(id string, config CommunicationConfig) error
 	Execute(id string, request Request) error
+	// ExecuteContext is Execute giving up once ctx ends while the queue is full;
+	// Execute waits as long as it takes.
+	ExecuteContext(ctx context.Context, id string, request Request) error
+	// ExecuteWithFds is ExecuteContext sending fds as SCM_RIGHTS ancillary data
+	// along with the request. The queue takes ownership of fds and closes them once
+	// they are sent or the request failed.
+	ExecuteWithFds(ctx context.Context, id string, request Request, fds []int) error
+	// Resync executes a guest-sync-delimited request on a QEMU Guest Agent connection:
+	// the 0xFF sentinel is written ahead of it to flush the agent's parser, and input
+	// is discarded until the sentinel the agent sends ahead of its reply.
+	Resync(id string, request Request) error
 	Cancel(requestId string) error
+	Remove(id string) error
+	// Listen accepts connections on the endpoint described by config and reports
+	// each one with ActionAccept; it is up to the receiver to Attach or close it.
+	Listen(id string, config CommunicationConfig) error
+	// Attach hands an accepted connection over to the queue as the instance id,
+	// reported with ActionAdd like a connection made by Add. The queue owns fd
+	// from then on.
+	Attach(id string, fd int) error
 	Close() error
 }
@@ -20,13 +20,50 @@ from qapi.schema import (
     QAPISchemaVisitor,
 )
 from qapi.source import QAPISourceInfo
-from utils import get_environment
+from utils import capitalize, get_environment, to_go_camel_case
+
+
+# Special QAPI features reflected in the generated code
+_SPECIAL_FEATURES = ("deprecated", "unstable")
+
+
+def special_features(features: Optional[List[QAPISchemaFeature]]) -> list[str]:
+    return [f.name for f in features or [] if f.name in _SPECIAL_FEATURES]
+
+
+def go_condition(ifcond: Optional[QAPISchemaIfCond]) -> Optional[str]:
+    """Renders an 'if' condition as a client.Condition composite literal."""
+    cond = getattr(ifcond, "ifcond", None)
+    if not cond:
+        return None
+
+    def render(c) -> str:
+        if isinstance(c, str):
+            return f'client.Condition{{Name: "{c}"}}'
+        if "not" in c:
+            return f"client.Condition{{Not: &{render(c['not'])}}}"
+        key = "all" if "all" in c else "any"
+        operands = ", ".join(render(o) for o in c[key])
+        return f"client.Condition{{{capitalize(key)}: []client.Condition{{{operands}}}}}"
+
+    return render(cond)
+
+
+@dataclass
+class EnumValue:
+    name: str
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
 
 
 @dataclass
 class Enumeration:
     name: str
-    values: list[str] = field(default_factory=list)
+    values: list[EnumValue] = field(default_factory=list)
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
 
 
 @dataclass
@@ -34,12 +71,57 @@ class Field:
     name: str
     typename: str
     optional: Optional[bool] = False
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
+
+
+@dataclass
+class Variant:
+    # Discriminator value selecting the branch
+    name: str
+    typename: str
+    # Go field holding the branch members
+    field: str
+    # The branch's own and those of its discriminator value
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+
+
+@dataclass
+class Alternative:
+    name: str
+    typename: str
+    # client.JSON* constant naming the JSON value kind selecting the alternative
+    kind: str
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+
+
+# QAPI json_type() of an alternative to the client.JSONKind constant
+_JSON_KINDS = {
+    "object": "JSONObject",
+    "array": "JSONArray",
+    "string": "JSONString",
+    "number": "JSONNumber",
+    "int": "JSONNumber",
+    "boolean": "JSONBoolean",
+    "null": "JSONNull",
+}
 
 
 @dataclass
 class Type:
     name: str
     fields: List[Field] = field(default_factory=list)
+    # Flat unions only: JSON name of the discriminator member and the branches
+    discriminator: Optional[str] = None
+    variants: List[Variant] = field(default_factory=list)
+    # Alternates only: the alternatives, tried by the kind of the JSON value
+    alternatives: List[Alternative] = field(default_factory=list)
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
 
 
 @dataclass
@@ -53,12 +135,20 @@ class Method:
     name: str
     arg: Optional[str] = None
     ret: Optional[str] = None
+    success_response: bool = True
+    allow_oob: bool = False
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
 
 
 @dataclass
 class Event:
     name: str
     arg: Optional[str] = None
+    features: list[str] = field(default_factory=list)
+    condition: Optional[str] = None
+    doc: list[str] = field(default_factory=list)
 
 
 @dataclass
@@ -76,6 +166,235 @@ class Registry:
     modules: list[Module] = field(default_factory=list)
 
 
+@dataclass
+class CompatPolicy:
+    """Mirrors QEMU's -compat option: input "reject" omits the commands carrying the
+    feature and such members, branches and alternatives of the types commands take,
+    output "hide" omits such events and the same of the types commands return and
+    events carry. Types are walked down to every type they contain."""
+
+    deprecated_input: str = "accept"
+    deprecated_output: str = "accept"
+    unstable_input: str = "accept"
+    unstable_output: str = "accept"
+
+    @classmethod
+    def parse(cls, spec: str) -> "CompatPolicy":
+        # e.g. "deprecated-input=reject,deprecated-output=hide"
+        policy = cls()
+        for item in filter(None, (s.strip() for s in spec.split(","))):
+            key, _, value = item.partition("=")
+            attr = key.replace("-", "_")
+            if not hasattr(policy, attr) or not value:
+                raise ValueError(f"invalid compat policy {item!r}")
+            setattr(policy, attr, value)
+        return policy
+
+    def rejects_input(self, features: list[str]) -> bool:
+        return ("deprecated" in features and self.deprecated_input == "reject") or (
+            "unstable" in features and self.unstable_input == "reject"
+        )
+
+    def hides_output(self, features: list[str]) -> bool:
+        return ("deprecated" in features and self.deprecated_output == "hide") or (
+            "unstable" in features and self.unstable_output == "hide"
+        )
+
+    def apply(self, registry: Registry) -> None:
+        elements = {
+            array.name: array.element_type
+            for module in registry.modules
+            for array in module.arrays
+        }
+        types = {t.name: t for module in registry.modules for t in module.types}
+
+        def walk(name: Optional[str], omits, seen: set[str]) -> None:
+            name = elements.get(name, name)
+            if name in seen or name not in types:
+                return
+            seen.add(name)
+            t = types[name]
+            t.fields = [f for f in t.fields if not omits(f.features)]
+            t.variants = [v for v in t.variants if not omits(v.features)]
+            t.alternatives = [a for a in t.alternatives if not omits(a.features)]
+            for member in [*t.fields, *t.variants, *t.alternatives]:
+                walk(member.typename, omits, seen)
+
+        inputs: set[str] = set()
+        outputs: set[str] = set()
+        for module in registry.modules:
+            module.methods = [
+                m for m in module.methods if not self.rejects_input(m.features)
+            ]
+            module.events = [
+                e for e in module.events if not self.hides_output(e.features)
+            ]
+            for method in module.methods:
+                walk(method.arg, self.rejects_input, inputs)
+                walk(method.ret, self.hides_output, outputs)
+            for event in module.events:
+                walk(event.arg, self.hides_output, outputs)
+
+
+# Package-level identifiers the templates declare besides those named after entities
+_FIXED_IDENTIFIERS = (
+    "Null",
+    "QEmpty",
+    "Request",
+    "GenerateId",
+    "EventProcessor",
+    "ProcessEvent",
+    "DefaultEventProcessor",
+    "Features",
+    "Conditions",
+    "OOBCommands",
+    "AllowsOOB",
+)
+
+
+def check_identifiers(registry: Registry) -> None:
+    """Fails if two schema entities map to the same Go identifier, which would
+    leave the generated package uncompilable."""
+    declared = {name: "generated code" for name in _FIXED_IDENTIFIERS}
+
+    def declare(name: str, entity: str) -> None:
+        if name in declared and declared[name] != entity:
+            raise ValueError(
+                f"{entity} and {declared[name]} are both generated as {name}"
+            )
+        declared[name] = entity
+
+    for module in registry.modules:
+        for array in module.arrays:
+            declare(capitalize(to_go_camel_case(array.name)), array.name)
+        if QAPISchemaModule.is_builtin_module(module.name):
+            continue
+        for enum in module.enums:
+            enum_name = capitalize(to_go_camel_case(enum.name))
+            declare(enum_name, enum.name)
+            for value in enum.values:
+                declare(
+                    enum_name + capitalize(to_go_camel_case(value.name)),
+                    f"{enum.name}.{value.name}",
+                )
+        for t in module.types:
+            declare(capitalize(to_go_camel_case(t.name)), t.name)
+        for method in module.methods:
+            name = capitalize(to_go_camel_case(method.name))
+            declare(f"Prepare{name}Request", method.name)
+            if method.allow_oob:
+                declare(f"Prepare{name}OOBRequest", method.name)
+            if method.success_response:
+                declare(f"Exec{name}", method.name)
+        for event in module.events:
+            declare(f"On{capitalize(to_go_camel_case(event.name))}", event.name)
+
+
+def collect(registry: Registry, attr: str) -> dict:
+    """Maps commands, events and types, and "type.member" for members, union
+    branches, alternatives and enum values, to their attr, leaving out entities
+    where it is empty."""
+    collected = {}
+
+    def add(name: str, entity) -> None:
+        if getattr(entity, attr):
+            collected[name] = getattr(entity, attr)
+
+    for module in registry.modules:
+        for enum in module.enums:
+            add(enum.name, enum)
+            for value in enum.values:
+                add(f"{enum.name}.{value.name}", value)
+        for t in module.types:
+            add(t.name, t)
+            for member in [*t.fields, *t.variants, *t.alternatives]:
+                add(f"{t.name}.{member.name}", member)
+        for method in module.methods:
+            add(method.name, method)
+        for event in module.events:
+            add(event.name, event)
+    return dict(sorted(collected.items()))
+
+
+def section_kind(section) -> str:
+    """Returns the lower-case kind of a QAPIDoc section, e.g. "since" or "returns"."""
+    # QEMU 9.1 replaced Section.tag ("Since", "Returns", None for plain text)
+    # with Section.kind (QAPIDoc.Kind.SINCE, ...)
+    kind = getattr(section, "kind", None)
+    if kind is not None:
+        return str(getattr(kind, "name", kind)).lower()
+    tag = getattr(section, "tag", None)
+    return tag.lower() if tag else "plain"
+
+
+def doc_lines(text: Optional[str]) -> list[str]:
+    lines = [line.rstrip() for line in (text or "").strip().splitlines()]
+    # collapse runs of blank lines, they become a single "//"
+    return [l for i, l in enumerate(lines) if l or (i > 0 and lines[i - 1])]
+
+
+def definition_doc(doc) -> list[str]:
+    """Returns the doc comment of a definition: its description, what it returns
+    and the version it appeared in."""
+    if doc is None:
+        return []
+    body = getattr(doc, "body", None)
+    lines = doc_lines(body.text if body else "")
+
+    tagged = {}
+    for section in getattr(doc, "sections", []):
+        tagged.setdefault(section_kind(section), section)
+    for kind in ("returns", "since"):
+        # newer QAPIDoc keeps these out of .sections
+        if getattr(doc, kind, None) is not None:
+            tagged[kind] = getattr(doc, kind)
+
+    for kind in ("returns", "since"):
+        text = doc_lines(tagged[kind].text) if kind in tagged else []
+        if not text:
+            continue
+        if lines:
+            lines.append("")
+        lines.append(f"{kind.capitalize()}: {text[0]}")
+        lines.extend(text[1:])
+    return lines
+
+
+def member_doc(doc, name: str) -> list[str]:
+    if doc is None or name not in doc.args:
+        return []
+    return doc_lines(doc.args[name].text)
+
+
+def apply_docs(registry: Registry, docs: dict) -> None:
+    """Fills the doc comments from the QAPIDoc of each definition. Members of the
+    implicit argument types of commands and events are documented by their owner."""
+    owners = {}
+    for module in registry.modules:
+        for method in module.methods:
+            if method.arg:
+                owners[method.arg] = docs.get(method.name)
+            method.doc = definition_doc(docs.get(method.name))
+        for event in module.events:
+            if event.arg:
+                owners[event.arg] = docs.get(event.name)
+            event.doc = definition_doc(docs.get(event.name))
+
+    for module in registry.modules:
+        for enum in module.enums:
+            doc = docs.get(enum.name)
+            enum.doc = definition_doc(doc)
+            for value in enum.values:
+                value.doc = member_doc(doc, value.name)
+        for t in module.types:
+            doc = docs.get(t.name)
+            t.doc = definition_doc(doc)
+            if doc is None:
+                doc = owners.get(t.name)
+            for f in t.fields:
+                f.doc = member_doc(doc, f.name)
+
+
 class QAPIGoVisitor(QAPISchemaVisitor):
     registry: Registry
     visited: set[str]
@@ -118,9 +437,19 @@ class QAPIGoVisitor(QAPISchemaVisitor):
         members: List[QAPISchemaEnumMember],
         prefix: Optional[str],
     ) -> None:
-        enumeration = Enumeration(name=name)
+        enumeration = Enumeration(
+            name=name,
+            features=special_features(features),
+            condition=go_condition(ifcond),
+        )
         for m in members:
-            enumeration.values.append(m.name)
+            enumeration.values.append(
+                EnumValue(
+                    name=m.name,
+                    features=special_features(m.features),
+                    condition=go_condition(m.ifcond),
+                )
+            )
         if self.registry.modules:
             self.registry.modules[-1].enums.append(enumeration)
 
@@ -145,20 +474,46 @@ class QAPIGoVisitor(QAPISchemaVisitor):
         members: List[QAPISchemaObjectTypeMember],
         branches: Optional[QAPISchemaBranches],
     ) -> None:
-        obj = Type(name=name)
-        if branches:
-            for v in branches.variants:
-                obj.fields.append(
-                    Field(name=v.name, typename=v.type.name, optional=True)
-                )
+        obj = Type(
+            name=name,
+            features=special_features(features),
+            condition=go_condition(ifcond),
+        )
         for member in members:
             obj.fields.append(
                 Field(
                     name=member.name,
                     typename=member.type.name,
                     optional=member.optional,
+                    features=special_features(member.features),
+                    condition=go_condition(member.ifcond),
                 )
             )
+        if branches:
+            # Branch members are inlined next to the base members on the wire, the
+            # generated MarshalJSON/UnmarshalJSON pick the branch by the discriminator
+            obj.discriminator = branches.tag_member.name
+            tag_features = {
+                m.name: special_features(m.features)
+                for m in getattr(branches.tag_member.type, "members", [])
+            }
+            taken = {capitalize(to_go_camel_case(f.name)) for f in obj.fields}
+            for v in branches.variants:
+                if v.type.name == "q_empty":
+                    continue
+                go_name = capitalize(to_go_camel_case(v.name))
+                if go_name in taken:
+                    go_name += "Branch"
+                obj.variants.append(
+                    Variant(
+                        name=v.name,
+                        typename=v.type.name,
+                        field=go_name,
+                        features=special_features(getattr(v, "features", None))
+                        + tag_features.get(v.name, []),
+                        condition=go_condition(v.ifcond),
+                    )
+                )
         if self.registry.modules:
             self.registry.modules[-1].types.append(obj)
 
@@ -170,9 +525,21 @@ class QAPIGoVisitor(QAPISchemaVisitor):
         features: List[QAPISchemaFeature],
         alternatives: QAPISchemaAlternatives,
     ) -> None:
-        obj = Type(name=name)
+        obj = Type(
+            name=name,
+            features=special_features(features),
+            condition=go_condition(ifcond),
+        )
         for v in alternatives.variants:
-            obj.fields.append(Field(name=v.name, typename=v.type.name, optional=True))
+            obj.alternatives.append(
+                Alternative(
+                    name=v.name,
+                    typename=v.type.name,
+                    kind=_JSON_KINDS[v.type.json_type()],
+                    features=special_features(getattr(v, "features", None)),
+                    condition=go_condition(v.ifcond),
+                )
+            )
         if self.registry.modules:
             self.registry.modules[-1].types.append(obj)
 
@@ -194,6 +561,10 @@ class QAPIGoVisitor(QAPISchemaVisitor):
         method = Method(name=name)
         method.ret = ret_type.name if ret_type else None
         method.arg = arg_type.name if arg_type else None
+        method.success_response = success_response
+        method.allow_oob = allow_oob
+        method.features = special_features(features)
+        method.condition = go_condition(ifcond)
         if self.registry.modules:
             self.registry.modules[-1].methods.append(method)
 
@@ -206,7 +577,12 @@ class QAPIGoVisitor(QAPISchemaVisitor):
         arg_type: Optional[QAPISchemaObjectType],
         boxed: bool,
     ) -> None:
-        event = Event(name=name, arg=arg_type.name if arg_type else None)
+        event = Event(
+            name=name,
+            arg=arg_type.name if arg_type else None,
+            features=special_features(features),
+            condition=go_condition(ifcond),
+        )
         if self.registry.modules:
             self.registry.modules[-1].events.append(event)
 
@@ -227,6 +603,13 @@ class QAPIGoBackend(QAPIBackend):
 
         vis = QAPIGoVisitor()
         schema.visit(vis)
+        apply_docs(
+            vis.registry, {doc.symbol: doc for doc in schema.docs if doc.symbol}
+        )
+        # The features table describes the whole schema, before the policy omits anything
+        features = collect(vis.registry, "features")
+        CompatPolicy.parse(os.environ.get("QAPI_GO_COMPAT", "")).apply(vis.registry)
+        check_identifiers(vis.registry)
 
         dir = os.path.join(output_dir, pkg)
         os.makedirs(dir, exist_ok=True)
@@ -240,7 +623,9 @@ class QAPIGoBackend(QAPIBackend):
                 with open(os.path.join(dir, "builtin.go"), "w") as f:
                     f.write(template)
                 continue
-            moduleName = os.path.splitext(module.name)[0]
+            # Modules of other schemas are named by their relative path
+            # (e.g. ../../qapi/block-core.json), keep the files inside dir
+            moduleName = os.path.splitext(os.path.basename(module.name))[0]
             template = env.get_template("module.jinja2")
             with open(os.path.join(dir, f"{moduleName}types.go"), "w") as f:
                 f.write(template.render(module=module, pkg=pkg, moduleName=moduleName))
@@ -260,6 +645,28 @@ class QAPIGoBackend(QAPIBackend):
         with open(os.path.join(dir, "events.go"), "w") as f:
             f.write(template.render(events=events.values(), pkg=pkg))
 
+        template = env.get_template("features.go.jinja2")
+        with open(os.path.join(dir, "features.go"), "w") as f:
+            f.write(template.render(features=features, pkg=pkg))
+
+        template = env.get_template("conditions.go.jinja2")
+        with open(os.path.join(dir, "conditions.go"), "w") as f:
+            f.write(
+                template.render(
+                    conditions=collect(vis.registry, "condition"), pkg=pkg
+                )
+            )
+
+        oob = sorted(
+            method.name
+            for module in vis.registry.modules
+            for method in module.methods
+            if method.allow_oob
+        )
+        template = env.get_template("oob.go.jinja2")
+        with open(os.path.join(dir, "oob.go"), "w") as f:
+            f.write(template.render(commands=oob, pkg=pkg))
+
         # optionally apply go fmt to all go files in dir if go compiler exists
         if shutil.which("go") is not None:
             try:
@@ -0,0 +1,29 @@
+package golden
+
+import "testing"
+
+type cancelledProcessor struct {
+	DefaultEventProcessor
+	devices []string
+}
+
+func (p *cancelledProcessor) ProcessBLOCKJOBCANCELLED(arg QObjBLOCKJOBCANCELLEDArg) error {
+	p.devices = append(p.devices, arg.Device)
+	return nil
+}
+
+func TestProcessEvent(t *testing.T) {
+	p := &cancelledProcessor{}
+	if err := ProcessEvent(p, "BLOCK_JOB_CANCELLED", []byte(`{"device":"disk0"}`)); err != nil {
+		t.Fatalf("ProcessEvent: %v", err)
+	}
+	if err := ProcessEvent(p, "STOP", nil); err != nil {
+		t.Fatalf("ProcessEvent without data: %v", err)
+	}
+	if len(p.devices) != 1 || p.devices[0] != "disk0" {
+		t.Errorf("devices = %v, want [disk0]", p.devices)
+	}
+	if err := ProcessEvent(p, "BLOCK_JOB_CANCELLED", []byte(`[]`)); err == nil {
+		t.Error("ProcessEvent accepted malformed event data")
+	}
+}
@@ -0,0 +1,124 @@
+package golden
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the generator output")
+
+// generate runs qapi-gen.py with the Go backend and the compat policy on
+// testdata/schema.json and returns the directory holding the generated package.
+// It skips the test when the qemu submodule or jinja2 is missing; generate.sh
+// leaves a venv with jinja2 behind.
+func generate(t *testing.T, pkg, compat string) string {
+	t.Helper()
+	root, rootErr := filepath.Abs(filepath.Join("..", "..", ".."))
+	if rootErr != nil {
+		t.Fatal(rootErr)
+	}
+	qapiGen := filepath.Join(root, "qemu", "scripts", "qapi-gen.py")
+	if _, err := os.Stat(qapiGen); err != nil {
+		t.Skip("qemu submodule is not checked out")
+	}
+	python := filepath.Join(root, ".venv", "bin", "python3")
+	if _, err := os.Stat(python); err != nil {
+		python = "python3"
+	}
+	if err := exec.Command(python, "-c", "import jinja2").Run(); err != nil {
+		t.Skipf("jinja2 is not available to %s", python)
+	}
+
+	out := t.TempDir()
+	cmd := exec.Command(python, qapiGen, "-o", out, filepath.Join("testdata", "schema.json"),
+		"--backend", "gobackend.QAPIGoBackend", "--prefix", pkg)
+	cmd.Env = append(os.Environ(),
+		"PYTHONPATH="+filepath.Join(root, "src", "generator"),
+		"QAPI_GO_COMPAT="+compat,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("qapi-gen.py: %v\n%s", err, output)
+	}
+	return filepath.Join(out, pkg)
+}
+
+// TestGolden checks that the Go files of this package, and of compat for the
+// -compat policy below, are what the generator produces for testdata/schema.json;
+// go test -run TestGolden -update rewrites them.
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		pkg    string
+		dir    string
+		compat string
+	}{
+		{pkg: "golden", dir: "."},
+		{pkg: "compat", dir: "compat", compat: "deprecated-input=reject,deprecated-output=hide"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pkg, func(t *testing.T) {
+			compare(t, generate(t, tt.pkg, tt.compat), tt.dir)
+		})
+	}
+}
+
+// compare checks the Go files of dir against the generated ones in generatedDir.
+func compare(t *testing.T, generatedDir, dir string) {
+	generated, generatedErr := filepath.Glob(filepath.Join(generatedDir, "*.go"))
+	if generatedErr != nil {
+		t.Fatal(generatedErr)
+	}
+	names := make([]string, 0, len(generated))
+	for _, path := range generated {
+		names = append(names, filepath.Base(path))
+	}
+
+	for _, name := range names {
+		want, wantErr := os.ReadFile(filepath.Join(generatedDir, name))
+		if wantErr != nil {
+			t.Fatal(wantErr)
+		}
+		path := filepath.Join(dir, name)
+		if *update {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, want, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		got, gotErr := os.ReadFile(path)
+		if gotErr != nil {
+			t.Errorf("%s is not in the golden files: %v", path, gotErr)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from the generator output, rerun with -update", path)
+		}
+	}
+
+	golden, goldenErr := filepath.Glob(filepath.Join(dir, "*.go"))
+	if goldenErr != nil {
+		t.Fatal(goldenErr)
+	}
+	for _, path := range golden {
+		name := filepath.Base(path)
+		if strings.HasSuffix(name, "_test.go") || slices.Contains(names, name) {
+			continue
+		}
+		if *update {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		t.Errorf("%s is not generated anymore", path)
+	}
+}
@@ -0,0 +1,115 @@
+package golden
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFlatUnionRoundTrip(t *testing.T) {
+	nodeName := "disk0"
+	lazy := true
+	tests := []struct {
+		name  string
+		value BlockdevOptions
+		wire  string
+	}{
+		{
+			name:  "Branch members are inlined",
+			value: BlockdevOptions{Driver: BlockdevDriverQcow2, NodeName: &nodeName, Qcow2: &BlockdevOptionsQcow2{File: "file0", LazyRefcounts: &lazy}},
+			wire:  `{"driver":"qcow2","file":"file0","lazy-refcounts":true,"node-name":"disk0"}`,
+		},
+		{
+			name:  "Alternate member",
+			value: BlockdevOptions{Driver: BlockdevDriverQcow2, Qcow2: &BlockdevOptionsQcow2{File: "file0", Backing: &BlockdevRefOrNull{Reference: &nodeName}}},
+			wire:  `{"backing":"disk0","driver":"qcow2","file":"file0"}`,
+		},
+		{
+			name:  "Other branch",
+			value: BlockdevOptions{Driver: BlockdevDriverFile, File: &BlockdevOptionsFile{Filename: "/tmp/disk.img"}},
+			wire:  `{"driver":"file","filename":"/tmp/disk.img"}`,
+		},
+		{
+			name:  "Branch without members",
+			value: BlockdevOptions{Driver: BlockdevDriverNullCo},
+			wire:  `{"driver":"null-co"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != tt.wire {
+				t.Errorf("Marshal = %s, want %s", data, tt.wire)
+			}
+
+			var decoded BlockdevOptions
+			if err := json.Unmarshal([]byte(tt.wire), &decoded); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("Unmarshal = %+v, want %+v", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestAlternateRoundTrip(t *testing.T) {
+	reference := "disk0"
+	tests := []struct {
+		name  string
+		value BlockdevRefOrNull
+		wire  string
+	}{
+		{
+			name:  "String alternative",
+			value: BlockdevRefOrNull{Reference: &reference},
+			wire:  `"disk0"`,
+		},
+		{
+			name:  "Object alternative",
+			value: BlockdevRefOrNull{Definition: &BlockdevOptions{Driver: BlockdevDriverFile, File: &BlockdevOptionsFile{Filename: "/tmp/disk.img"}}},
+			wire:  `{"driver":"file","filename":"/tmp/disk.img"}`,
+		},
+		{
+			name:  "Null alternative",
+			value: BlockdevRefOrNull{Null: &Null{}},
+			wire:  `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(struct {
+				Ref BlockdevRefOrNull `json:"ref"`
+			}{Ref: tt.value})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if want := `{"ref":` + tt.wire + `}`; string(data) != want {
+				t.Errorf("Marshal = %s, want %s", data, want)
+			}
+
+			var decoded struct {
+				Ref BlockdevRefOrNull `json:"ref"`
+			}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(decoded.Ref, tt.value) {
+				t.Errorf("Unmarshal = %+v, want %+v", decoded.Ref, tt.value)
+			}
+		})
+	}
+
+	if _, err := json.Marshal(BlockdevRefOrNull{}); err == nil {
+		t.Error("Marshal accepted an alternate without any alternative set")
+	}
+	var ref BlockdevRefOrNull
+	if err := json.Unmarshal([]byte(`42`), &ref); err == nil {
+		t.Error("Unmarshal accepted a number for an alternate without a numeric alternative")
+	}
+}
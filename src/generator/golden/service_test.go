@@ -0,0 +1,28 @@
+package golden
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPrepareOOBRequest(t *testing.T) {
+	req, err := PrepareMigrateRecoverOOBRequest(QObjMigrateRecoverArg{Uri: "tcp:0:4444"})
+	if err != nil {
+		t.Fatalf("PrepareMigrateRecoverOOBRequest: %v", err)
+	}
+	req.Id = "1"
+	data, dataErr := json.Marshal(req)
+	if dataErr != nil {
+		t.Fatalf("Marshal: %v", dataErr)
+	}
+	if want := `{"id":"1","exec-oob":"migrate-recover","arguments":{"uri":"tcp:0:4444"}}`; string(data) != want {
+		t.Errorf("request = %s, want %s", data, want)
+	}
+
+	if !AllowsOOB("migrate-recover") {
+		t.Error("migrate-recover does not allow out-of-band execution")
+	}
+	if AllowsOOB("query-block-jobs") {
+		t.Error("query-block-jobs allows out-of-band execution")
+	}
+}
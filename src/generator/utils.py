@@ -56,6 +56,25 @@ def builtin_to_go(name: str) -> str:
     return name
 
 
+def deprecation(features, name: str, indent: str = "", paragraph: bool = False) -> str:
+    """Returns the "Deprecated:" doc comment lines for a deprecated entity, if any."""
+    if "deprecated" not in features:
+        return ""
+    comment = f"{indent}// Deprecated: {name} is deprecated by the QAPI schema.\n"
+    if paragraph:
+        comment = f"{indent}//\n" + comment
+    return comment
+
+
+def doc_comment(lines, features, name: str, indent: str = "") -> str:
+    """Returns the doc comment made of the schema documentation lines, followed by
+    the "Deprecated:" paragraph for a deprecated entity."""
+    comment = "".join(
+        f"{indent}// {line}\n" if line else f"{indent}//\n" for line in lines
+    )
+    return comment + deprecation(features, name, indent, paragraph=bool(lines))
+
+
 def capitalize(s: str) -> str:
     return s[0].upper() + s[1:] if s else s
 
@@ -91,5 +110,7 @@ def get_environment(path) -> Environment:
     env.globals["uncapitalize"] = uncapitalize
     env.globals["builtin_to_go"] = builtin_to_go
     env.globals["is_builtin_type"] = is_builtin_type
+    env.globals["deprecation"] = deprecation
+    env.globals["doc_comment"] = doc_comment
 
     return env
@@ -0,0 +1,178 @@
+// Package introspect answers questions about the QAPI schema an instance actually
+// implements, as reported by query-qmp-schema. Type names in that reply are masked
+// (e.g. "135"); command and event names, members and enum values are not.
+package introspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// Meta types of SchemaInfo.
+const (
+	MetaBuiltin   = "builtin"
+	MetaEnum      = "enum"
+	MetaArray     = "array"
+	MetaObject    = "object"
+	MetaAlternate = "alternate"
+	MetaCommand   = "command"
+	MetaEvent     = "event"
+)
+
+var ErrInvalidSchema = fmt.Errorf("invalid query-qmp-schema reply")
+
+// SchemaInfoMember is a member of an object, enum or alternate. Objects fill Name
+// and Type, enums Name and alternates Type.
+type SchemaInfoMember struct {
+	Name     string          `json:"name,omitempty"`
+	Type     string          `json:"type,omitempty"`
+	Default  json.RawMessage `json:"default,omitempty"`
+	Features []string        `json:"features,omitempty"`
+}
+
+// SchemaInfoVariant is a branch of a union, selected by the value of its tag member.
+type SchemaInfoVariant struct {
+	Case string `json:"case"`
+	Type string `json:"type"`
+}
+
+// SchemaInfo is one entity of the schema. Which fields are filled depends on MetaType.
+type SchemaInfo struct {
+	Name     string   `json:"name"`
+	MetaType string   `json:"meta-type"`
+	Features []string `json:"features,omitempty"`
+
+	// builtin
+	JSONType string `json:"json-type,omitempty"`
+	// enum, object and alternate
+	Members []SchemaInfoMember `json:"members,omitempty"`
+	// enum
+	Values []string `json:"values,omitempty"`
+	// array
+	ElementType string `json:"element-type,omitempty"`
+	// object
+	Tag      string              `json:"tag,omitempty"`
+	Variants []SchemaInfoVariant `json:"variants,omitempty"`
+	// command and event
+	ArgType  string `json:"arg-type,omitempty"`
+	RetType  string `json:"ret-type,omitempty"`
+	AllowOOB bool   `json:"allow-oob,omitempty"`
+}
+
+// Schema indexes the entities of a query-qmp-schema reply by name.
+type Schema struct {
+	entities map[string]*SchemaInfo
+}
+
+// Query executes query-qmp-schema on the instance.
+func Query(ctx context.Context, exec client.CommandExecutor, instance string) (*Schema, error) {
+	res, resErr := exec.ExecuteContext(ctx, instance, client.Request{
+		Id:      client.GenerateId(),
+		Execute: "query-qmp-schema",
+	})
+	if resErr != nil {
+		return nil, resErr
+	}
+	return Parse(res.Return)
+}
+
+// Parse decodes the return value of query-qmp-schema.
+func Parse(data []byte) (*Schema, error) {
+	var infos []*SchemaInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+
+	schema := &Schema{
+		entities: make(map[string]*SchemaInfo, len(infos)),
+	}
+	for _, info := range infos {
+		if info == nil || info.Name == "" {
+			return nil, fmt.Errorf("%w: entity without a name", ErrInvalidSchema)
+		}
+		schema.entities[info.Name] = info
+	}
+	return schema, nil
+}
+
+// Lookup returns the entity with the given (possibly masked) name.
+func (s *Schema) Lookup(name string) (*SchemaInfo, bool) {
+	info, ok := s.entities[name]
+	return info, ok
+}
+
+// HasCommand reports whether the instance implements the command.
+func (s *Schema) HasCommand(name string) bool {
+	return s.hasMetaType(name, MetaCommand)
+}
+
+// HasEvent reports whether the instance may emit the event.
+func (s *Schema) HasEvent(name string) bool {
+	return s.hasMetaType(name, MetaEvent)
+}
+
+// HasArgument reports whether the command accepts the argument. Nested members are
+// addressed with a dotted path (e.g. "options.driver"); members of union branches
+// and of the object alternatives of alternates count as well.
+func (s *Schema) HasArgument(command, argument string) bool {
+	info, ok := s.entities[command]
+	if !ok || info.MetaType != MetaCommand || info.ArgType == "" || argument == "" {
+		return false
+	}
+
+	types := []string{info.ArgType}
+	for _, name := range strings.Split(argument, ".") {
+		var next []string
+		for _, typeName := range types {
+			next = append(next, s.memberTypes(typeName, name, map[string]bool{})...)
+		}
+		if len(next) == 0 {
+			return false
+		}
+		types = next
+	}
+	return true
+}
+
+func (s *Schema) hasMetaType(name, metaType string) bool {
+	info, ok := s.entities[name]
+	return ok && info.MetaType == metaType
+}
+
+// memberTypes returns the types of the member called name of typeName. There may be
+// several, as union branches and alternatives can declare the same member differently.
+func (s *Schema) memberTypes(typeName, name string, visited map[string]bool) []string {
+	if visited[typeName] {
+		return nil
+	}
+	visited[typeName] = true
+
+	info, ok := s.entities[typeName]
+	if !ok {
+		return nil
+	}
+
+	var types []string
+	switch info.MetaType {
+	case MetaObject:
+		for _, member := range info.Members {
+			if member.Name == name {
+				types = append(types, member.Type)
+			}
+		}
+		for _, variant := range info.Variants {
+			types = append(types, s.memberTypes(variant.Type, name, visited)...)
+		}
+	case MetaAlternate:
+		for _, member := range info.Members {
+			types = append(types, s.memberTypes(member.Type, name, visited)...)
+		}
+	case MetaArray:
+		types = append(types, s.memberTypes(info.ElementType, name, visited)...)
+	}
+	return types
+}
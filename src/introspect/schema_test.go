@@ -0,0 +1,107 @@
+package introspect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// fakeExecutor answers query-qmp-schema with the fixture.
+type fakeExecutor struct {
+	reply    []byte
+	requests []client.Request
+}
+
+func (e *fakeExecutor) ExecuteContext(ctx context.Context, instance string, request client.Request) (*client.QAPIResult, error) {
+	e.requests = append(e.requests, request)
+	return &client.QAPIResult{Id: request.Id, Return: e.reply}, nil
+}
+
+func loadSchema(t *testing.T) *Schema {
+	t.Helper()
+	data, dataErr := os.ReadFile("testdata/schema.json")
+	if dataErr != nil {
+		t.Fatalf("ReadFile: %v", dataErr)
+	}
+
+	exec := &fakeExecutor{reply: data}
+	schema, err := Query(t.Context(), exec, "instance")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(exec.requests) != 1 || exec.requests[0].Execute != "query-qmp-schema" {
+		t.Fatalf("requests = %+v, want a single query-qmp-schema", exec.requests)
+	}
+	return schema
+}
+
+func TestSchemaHasCommandAndEvent(t *testing.T) {
+	schema := loadSchema(t)
+
+	tests := []struct {
+		name   string
+		check  func(string) bool
+		entity string
+		want   bool
+	}{
+		{"command", schema.HasCommand, "query-status", true},
+		{"missing command", schema.HasCommand, "query-foo", false},
+		{"event is not a command", schema.HasCommand, "SHUTDOWN", false},
+		{"masked type is not a command", schema.HasCommand, "1", false},
+		{"event", schema.HasEvent, "SHUTDOWN", true},
+		{"missing event", schema.HasEvent, "RESET", false},
+		{"command is not an event", schema.HasEvent, "query-status", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check(tt.entity); got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.entity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaHasArgument(t *testing.T) {
+	schema := loadSchema(t)
+
+	tests := []struct {
+		command  string
+		argument string
+		want     bool
+	}{
+		{"migrate-recover", "uri", true},
+		{"migrate-recover", "url", false},
+		{"query-status", "running", false},
+		{"blockdev-add", "node-name", true},
+		// union branches
+		{"blockdev-add", "filename", true},
+		{"blockdev-add", "file", true},
+		// nested through an alternate, recursing into the same union
+		{"blockdev-add", "file.driver", true},
+		{"blockdev-add", "file.filename", true},
+		{"blockdev-add", "file.size", false},
+		{"blockdev-add", "", false},
+		{"blockdev-foo", "driver", false},
+		{"SHUTDOWN", "guest", false},
+	}
+	for _, tt := range tests {
+		if got := schema.HasArgument(tt.command, tt.argument); got != tt.want {
+			t.Errorf("HasArgument(%q, %q) = %v, want %v", tt.command, tt.argument, got, tt.want)
+		}
+	}
+
+	if info, ok := schema.Lookup("migrate-recover"); !ok || !info.AllowOOB {
+		t.Errorf("Lookup(migrate-recover) = %+v, %v", info, ok)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{`{}`, `[{"meta-type": "command"}]`, `[null]`} {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("Parse(%s) error = %v, want %v", data, err, ErrInvalidSchema)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"sync"
+)
+
+// DeliveryPolicy decides what happens to a message when its consumer
+// (Messages() or a subscription) has a full buffer.
+type DeliveryPolicy int
+
+const (
+	// DeliverDropNewest discards the message that does not fit.
+	DeliverDropNewest DeliveryPolicy = iota
+	// DeliverDropOldest discards the oldest buffered message to make room. With
+	// no buffer it discards the message that no consumer is waiting for.
+	DeliverDropOldest
+	// DeliverBlock waits for the consumer. This applies backpressure to every
+	// instance: replies are not processed while the consumer lags behind.
+	DeliverBlock
+	// DeliverSpill queues the message in memory without bounds.
+	DeliverSpill
+)
+
+// outbox delivers values to a consumer channel according to a DeliveryPolicy
+// and owns that channel: it is closed by close, never while a send is in flight.
+type outbox[T any] struct {
+	policy DeliveryPolicy
+	ch     chan T
+	onDrop func(T)
+
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	doneCh    chan struct{}
+
+	spillMu   sync.Mutex
+	spill     []T
+	spillWake chan struct{}
+}
+
+func newOutbox[T any](size int, policy DeliveryPolicy, onDrop func(T)) *outbox[T] {
+	o := &outbox[T]{
+		policy:    policy,
+		ch:        make(chan T, size),
+		onDrop:    onDrop,
+		doneCh:    make(chan struct{}),
+		spillWake: make(chan struct{}, 1),
+	}
+	if policy == DeliverSpill {
+		go o.forward()
+	}
+	return o
+}
+
+func (o *outbox[T]) deliver(v T) {
+	if o.policy == DeliverSpill {
+		if o.isClosed() {
+			return
+		}
+		o.spillMu.Lock()
+		o.spill = append(o.spill, v)
+		o.spillMu.Unlock()
+		select {
+		case o.spillWake <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		return
+	}
+
+	switch o.policy {
+	case DeliverBlock:
+		select {
+		case o.ch <- v:
+		case <-o.doneCh:
+		}
+	case DeliverDropOldest:
+		for {
+			select {
+			case o.ch <- v:
+				return
+			case <-o.doneCh:
+				return
+			default:
+			}
+			// Without a buffer there is no older message to make room for v
+			if cap(o.ch) == 0 {
+				o.drop(v)
+				return
+			}
+			select {
+			case old := <-o.ch:
+				o.drop(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case o.ch <- v:
+		default:
+			o.drop(v)
+		}
+	}
+}
+
+// forward moves spilled values to the consumer channel in order.
+func (o *outbox[T]) forward() {
+	for {
+		o.spillMu.Lock()
+		if len(o.spill) == 0 {
+			o.spill = nil
+			o.spillMu.Unlock()
+			select {
+			case <-o.spillWake:
+				continue
+			case <-o.doneCh:
+				return
+			}
+		}
+		v := o.spill[0]
+		var zero T
+		o.spill[0] = zero
+		o.spill = o.spill[1:]
+		o.spillMu.Unlock()
+
+		if !o.send(v) {
+			return
+		}
+	}
+}
+
+func (o *outbox[T]) send(v T) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		return false
+	}
+
+	select {
+	case o.ch <- v:
+		return true
+	case <-o.doneCh:
+		return false
+	}
+}
+
+func (o *outbox[T]) isClosed() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.closed
+}
+
+func (o *outbox[T]) drop(v T) {
+	if o.onDrop != nil {
+		o.onDrop(v)
+	}
+}
+
+func (o *outbox[T]) close() {
+	// Unblock in-flight sends first, then wait for them before closing the channel
+	o.closeOnce.Do(func() {
+		close(o.doneCh)
+	})
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(o.ch)
+	}
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func drain[T any](ch <-chan T) []T {
+	var values []T
+	for {
+		select {
+		case v := <-ch:
+			values = append(values, v)
+		default:
+			return values
+		}
+	}
+}
+
+func TestOutboxPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		policy        DeliveryPolicy
+		wantDelivered []int
+		wantDropped   []int
+	}{
+		{
+			name:          "Drop newest",
+			size:          2,
+			policy:        DeliverDropNewest,
+			wantDelivered: []int{1, 2},
+			wantDropped:   []int{3, 4},
+		},
+		{
+			name:          "Drop oldest",
+			size:          2,
+			policy:        DeliverDropOldest,
+			wantDelivered: []int{3, 4},
+			wantDropped:   []int{1, 2},
+		},
+		{
+			name:        "Drop oldest without a buffer",
+			policy:      DeliverDropOldest,
+			wantDropped: []int{1, 2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dropped []int
+			box := newOutbox(tt.size, tt.policy, func(v int) {
+				dropped = append(dropped, v)
+			})
+			defer box.close()
+
+			for v := 1; v <= 4; v++ {
+				box.deliver(v)
+			}
+			if got := drain(box.ch); !reflect.DeepEqual(got, tt.wantDelivered) {
+				t.Errorf("delivered = %v, want %v", got, tt.wantDelivered)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestOutboxBlock(t *testing.T) {
+	box := newOutbox[int](1, DeliverBlock, func(v int) {
+		t.Errorf("dropped %d", v)
+	})
+	defer box.close()
+
+	box.deliver(1)
+	delivered := make(chan struct{})
+	go func() {
+		box.deliver(2)
+		close(delivered)
+	}()
+
+	select {
+	case <-delivered:
+		t.Fatal("deliver did not wait for the consumer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if v := <-box.ch; v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+	<-delivered
+	if v := <-box.ch; v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+}
+
+func TestOutboxSpill(t *testing.T) {
+	box := newOutbox[int](1, DeliverSpill, func(v int) {
+		t.Errorf("dropped %d", v)
+	})
+	defer box.close()
+
+	for v := range 1000 {
+		box.deliver(v)
+	}
+	for want := range 1000 {
+		select {
+		case v := <-box.ch:
+			if v != want {
+				t.Fatalf("received %d, want %d", v, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %d", want)
+		}
+	}
+}
+
+func TestOutboxClose(t *testing.T) {
+	for _, policy := range []DeliveryPolicy{DeliverDropNewest, DeliverDropOldest, DeliverBlock, DeliverSpill} {
+		box := newOutbox[int](1, policy, nil)
+		box.deliver(1)
+		blocked := make(chan struct{})
+		go func() {
+			box.deliver(2)
+			close(blocked)
+		}()
+		box.close()
+		box.close()
+		<-blocked
+		box.deliver(3)
+
+		for range box.ch {
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"os"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// instance tracks what the Monitor knows about a connection on top of the socket itself.
+type instance struct {
+	name         string
+	config       client.CommunicationConfig
+	options      addOptions
+	greetingCh   chan struct{}
+	greeting     *client.Greeting
+	capabilities []string
+	// disconnectedCh gets the error of a connection dropped while negotiating
+	disconnectedCh chan error
+	// ready is set once the instance entered command mode
+	ready bool
+	// reconnecting is set while the ReconnectPolicy is being applied
+	reconnecting bool
+	// syncing is set while a guest agent connection is being re-synchronized
+	syncing bool
+	// process is the process started for an AddProcess instance
+	process *os.Process
+	// hungUp is set once an AddProcess instance was removed because its stdio went
+	// away, and is yet to be reported with the exit status
+	hungUp bool
+}
+
+func newInstance(name string, config client.CommunicationConfig, options addOptions) *instance {
+	return &instance{
+		name:           name,
+		config:         config,
+		options:        options,
+		greetingCh:     make(chan struct{}, 1),
+		disconnectedCh: make(chan error, 1),
+	}
+}
+
+// reset forgets the state of the previous connection.
+func (i *instance) reset() {
+	i.greeting = nil
+	i.capabilities = nil
+	i.ready = false
+	select {
+	case <-i.greetingCh:
+	default:
+	}
+	select {
+	case <-i.disconnectedCh:
+	default:
+	}
+}
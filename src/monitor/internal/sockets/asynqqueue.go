@@ -3,11 +3,14 @@ package sockets
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"log/slog"
+	"sync"
 
 	"github.com/q-controller/qapi-client/src/client"
+	"github.com/q-controller/qapi-client/src/utils"
 	"golang.org/x/sys/unix"
 )
 
@@ -15,15 +18,39 @@ const (
 	cManagementEndpoint = "internal-management"
 )
 
-var ErrRequestCanceled = fmt.Errorf("request canceled")
+var ErrRequestCanceled = client.ErrRequestCanceled
 var ErrAddFailed = fmt.Errorf("failed to add instance")
+var ErrIdInUse = fmt.Errorf("id already in use")
 
 type AsyncQueue struct {
 	queue          *fdQueue
-	instances      map[string]Communicator
+	options        queueOptions
 	fd2Id          map[int]string
+	writeFd2Id     map[int]string
 	eventsCh       chan *client.Event
 	managementComm Communicator
+	listeners      map[int]*ListenConfig
+	done           chan struct{}
+
+	// instancesMu guards instances, which only the event loop modifies, against
+	// callers looking up a connection to queue a request on
+	instancesMu sync.RWMutex
+	instances   map[string]Communicator
+}
+
+type queueOptions struct {
+	writeQueueDepth int
+}
+
+// QueueOption customizes an AsyncQueue created with NewAsyncQueue.
+type QueueOption func(*queueOptions)
+
+// WithWriteQueueDepth sets how many writes may be queued for a connection before
+// Execute waits for room.
+func WithWriteQueueDepth(depth int) QueueOption {
+	return func(o *queueOptions) {
+		o.writeQueueDepth = depth
+	}
 }
 
 func (q *AsyncQueue) Wait(context context.Context) (iter.Seq[*client.Event], error) {
@@ -53,25 +80,73 @@ func (q *AsyncQueue) Close() error {
 }
 
 func (q *AsyncQueue) send(data ManagementData) error {
+	return q.sendContext(context.Background(), data)
+}
+
+// sendContext hands data over to the event loop, waiting for room in the
+// management queue until ctx ends.
+func (q *AsyncQueue) sendContext(ctx context.Context, data ManagementData) error {
 	bytes, bytesErr := json.Marshal(data)
 	if bytesErr != nil {
 		slog.Error("could not marshal management data", "error", bytesErr)
 		return bytesErr
 	}
-	return q.managementComm.Write(bytes)
+	return q.managementComm.WriteContext(ctx, bytes, nil)
 }
 
+// Add connects to the endpoint described by config and hands the connection over
+// to the event loop. Connecting happens in the caller's goroutine, so slow endpoints
+// (e.g. a TCP dial waiting for its timeout) never stall the other instances.
 func (q *AsyncQueue) Add(id string, config client.CommunicationConfig) error {
-	return q.send(ManagementData{
+	comm, commErr := buildCommunication(config)
+	if commErr != nil {
+		slog.Error("could not build communication", "error", commErr)
+		return commErr
+	}
+	readFd, writeFd, estErr := comm.Establish()
+	if estErr != nil {
+		return estErr
+	}
+
+	return q.attach(id, readFd, writeFd)
+}
+
+func (q *AsyncQueue) Attach(id string, fd int) error {
+	return q.attach(id, fd, fd)
+}
+
+func (q *AsyncQueue) attach(id string, readFd, writeFd int) error {
+	if err := q.send(ManagementData{
 		Action: client.ActionAdd,
 		Add: &AddConfig{
-			Id:     id,
-			Config: config,
+			Id:      id,
+			ReadFd:  readFd,
+			WriteFd: writeFd,
 		},
-	})
+	}); err != nil {
+		closeFds(readFd, writeFd)
+		return err
+	}
+
+	return nil
 }
 
 func (q *AsyncQueue) Execute(id string, request client.Request) error {
+	return q.ExecuteContext(context.Background(), id, request)
+}
+
+// ExecuteContext queues the request for the instance's writer, waiting for room
+// until ctx ends. It does not wait for the request to be written: a write failing
+// later on is reported as an ActionExecute event.
+func (q *AsyncQueue) ExecuteContext(ctx context.Context, id string, request client.Request) error {
+	return q.execute(ctx, id, request, nil)
+}
+
+func (q *AsyncQueue) ExecuteWithFds(ctx context.Context, id string, request client.Request, fds []int) error {
+	return q.execute(ctx, id, request, fds)
+}
+
+func (q *AsyncQueue) Resync(id string, request client.Request) error {
 	return q.send(ManagementData{
 		Action: client.ActionExecute,
 		Execute: &ExecuteConfig{
@@ -94,44 +169,301 @@ func (q *AsyncQueue) Cancel(requestId string) error {
 	})
 }
 
-func (q *AsyncQueue) registerCommunicator(id string, config client.CommunicationConfig) (Communicator, error) {
-	comm, commErr := buildCommunication(config)
-	if commErr != nil {
-		slog.Error("could not build communication", "error", commErr)
-		return nil, commErr
+// Remove closes the connection of the instance. Removing an instance whose
+// connection is already gone is not an error.
+func (q *AsyncQueue) Remove(id string) error {
+	return q.send(ManagementData{
+		Action: client.ActionRemove,
+		Remove: &RemoveConfig{
+			Id: id,
+		},
+	})
+}
+
+// Listen binds and listens in the caller's goroutine, like Add connects, and hands
+// the listening socket over to the event loop.
+func (q *AsyncQueue) Listen(id string, config client.CommunicationConfig) error {
+	fds, listenErr := listenSocket(config)
+	if listenErr != nil {
+		return listenErr
 	}
-	readFd, writeFd, estErr := comm.Establish()
-	if estErr != nil {
-		return nil, estErr
+	listen := &ListenConfig{
+		Id:  id,
+		Fds: fds,
+	}
+	if config.Type == client.UnixDomain {
+		listen.SocketPath = config.UnixDomain.SocketPath
 	}
 
-	if err := q.queue.Add(readFd); err != nil {
-		_ = unix.Close(readFd)
-		_ = unix.Close(writeFd)
-		return nil, err
+	if err := q.send(ManagementData{
+		Action: client.ActionListen,
+		Listen: listen,
+	}); err != nil {
+		closeListener(listen)
+		return err
+	}
+
+	return nil
+}
+
+// accept reports every pending connection of the listener. The queue is
+// edge-triggered, so it accepts until none are left.
+func (q *AsyncQueue) accept(listen *ListenConfig, listenFd int) {
+	for {
+		fd, remote, acceptErr := acceptConnection(listenFd)
+		if acceptErr != nil {
+			if errors.Is(acceptErr, unix.EINTR) || errors.Is(acceptErr, unix.ECONNABORTED) {
+				continue
+			}
+			if !errors.Is(acceptErr, unix.EAGAIN) {
+				slog.Error("could not accept connection", "listener", listen.Id, "error", acceptErr)
+			}
+			return
+		}
+
+		action := client.ActionAccept
+		q.eventsCh <- &client.Event{
+			Id:     listen.Id,
+			Action: &action,
+			Connection: &client.Connection{
+				Fd:     fd,
+				Remote: remote,
+			},
+		}
+	}
+}
+
+// unregisterListener stops accepting connections on the listener and closes it.
+// It reports whether id named a listener.
+func (q *AsyncQueue) unregisterListener(id string) bool {
+	var found *ListenConfig
+	for fd, listen := range q.listeners {
+		if listen.Id == id {
+			if delErr := q.queue.Delete(fd); delErr != nil {
+				slog.Error("could not remove fd from queue", "fd", fd, "error", delErr)
+			}
+			delete(q.listeners, fd)
+			found = listen
+		}
+	}
+	if found == nil {
+		return false
+	}
+	closeListener(found)
+	return true
+}
+
+// registerListener watches the listening sockets of the endpoint, closing them
+// if any of them cannot be watched.
+func (q *AsyncQueue) registerListener(listen *ListenConfig) error {
+	for i, fd := range listen.Fds {
+		if err := q.queue.Add(fd, readable); err != nil {
+			for _, added := range listen.Fds[:i] {
+				_ = q.queue.Delete(added)
+			}
+			closeListener(listen)
+			return err
+		}
+	}
+	for _, fd := range listen.Fds {
+		q.listeners[fd] = listen
+	}
+	return nil
+}
+
+func closeListener(listen *ListenConfig) {
+	closeAll(listen.Fds)
+	if listen.SocketPath != "" {
+		_ = unix.Unlink(listen.SocketPath)
+	}
+}
+
+// registerCommunicator watches the connection of a new instance, closing it
+// instead if id is already taken.
+func (q *AsyncQueue) registerCommunicator(id string, readFd, writeFd int) (Communicator, error) {
+	if _, exists := q.instances[id]; exists {
+		closeFds(readFd, writeFd)
+		return nil, fmt.Errorf("%w: %q", ErrIdInUse, id)
+	}
+	if readFd == writeFd {
+		if err := q.queue.Add(readFd, readable|writable); err != nil {
+			closeFds(readFd, writeFd)
+			return nil, err
+		}
+	} else {
+		if err := q.queue.Add(readFd, readable); err != nil {
+			closeFds(readFd, writeFd)
+			return nil, err
+		}
+		if err := q.queue.Add(writeFd, writable); err != nil {
+			_ = q.queue.Delete(readFd)
+			closeFds(readFd, writeFd)
+			return nil, err
+		}
 	}
 
-	q.instances[id] = newFdCommunicator(readFd, writeFd)
+	comm := newFdCommunicator(readFd, writeFd, q.options.writeQueueDepth)
+	q.instancesMu.Lock()
+	q.instances[id] = comm
+	q.instancesMu.Unlock()
 	q.fd2Id[readFd] = id
-	return q.instances[id], nil
+	q.writeFd2Id[writeFd] = id
+	return comm, nil
+}
+
+// unregisterCommunicator stops watching the instance's connection and closes it.
+func (q *AsyncQueue) unregisterCommunicator(id string) {
+	comm, commOk := q.instances[id]
+	if !commOk {
+		return
+	}
+	// the connection may read and write through the same fd
+	watched := map[int]struct{}{}
+	for _, fds := range []map[int]string{q.fd2Id, q.writeFd2Id} {
+		for fd, fdId := range fds {
+			if fdId == id {
+				watched[fd] = struct{}{}
+				delete(fds, fd)
+			}
+		}
+	}
+	for fd := range watched {
+		if delErr := q.queue.Delete(fd); delErr != nil {
+			slog.Error("could not remove fd from queue", "fd", fd, "error", delErr)
+		}
+	}
+	q.instancesMu.Lock()
+	delete(q.instances, id)
+	q.instancesMu.Unlock()
+	comm.Close()
+}
+
+// execute queues the request in the caller's goroutine, so a connection that is
+// slow to drain holds up its own callers only.
+func (q *AsyncQueue) execute(ctx context.Context, id string, request client.Request, fds []int) error {
+	q.instancesMu.RLock()
+	comm, commOk := q.instances[id]
+	q.instancesMu.RUnlock()
+	if !commOk || id == cManagementEndpoint {
+		closeAll(fds)
+		return fmt.Errorf("%w: unknown instance %q", client.ErrDisconnected, id)
+	}
+	bytes, bytesErr := json.Marshal(request)
+	if bytesErr != nil {
+		closeAll(fds)
+		return fmt.Errorf("%w: %w", client.ErrProtocol, bytesErr)
+	}
+	if writeErr := comm.WriteAsyncContext(ctx, bytes, fds, q.written(id, request.Id, fds)); writeErr != nil {
+		closeAll(fds)
+		return writeError(writeErr)
+	}
+	return nil
+}
+
+// resync queues the request behind a sentinel byte. It runs on the event loop,
+// which also runs the reader, so no reply can slip past the resync; it does not
+// wait for room in the queue for the same reason.
+func (q *AsyncQueue) resync(config *ExecuteConfig) error {
+	comm, commOk := q.instances[config.Id]
+	if !commOk {
+		return fmt.Errorf("%w: unknown instance %q", client.ErrDisconnected, config.Id)
+	}
+	bytes, bytesErr := json.Marshal(config.Request)
+	if bytesErr != nil {
+		return fmt.Errorf("%w: %w", client.ErrProtocol, bytesErr)
+	}
+	comm.Resync()
+	bytes = append([]byte{utils.Sentinel}, bytes...)
+	if writeErr := comm.WriteAsync(bytes, nil, q.written(config.Id, config.Request.Id, nil)); writeErr != nil {
+		return writeError(writeErr)
+	}
+	return nil
+}
+
+// written returns the Done callback of a request, which closes the fds passed
+// along and fails the request if it could not be written.
+func (q *AsyncQueue) written(id, requestId string, fds []int) func(error) {
+	return func(err error) {
+		closeAll(fds)
+		if err != nil {
+			slog.Error("could not execute request", "instance", id, "error", err)
+			// not holding up the writer while the event is delivered
+			go q.failRequest(requestId, writeError(err))
+		}
+	}
+}
+
+func (q *AsyncQueue) failRequest(requestId string, err error) {
+	action := client.ActionExecute
+	select {
+	case q.eventsCh <- &client.Event{
+		Id:     requestId,
+		Error:  err,
+		Action: &action,
+	}:
+	case <-q.done:
+	}
+}
+
+func writeError(err error) error {
+	switch {
+	case errors.Is(err, ErrRightsUnsupported):
+		return fmt.Errorf("%w: %w", client.ErrProtocol, err)
+	case errors.Is(err, ErrWriterChannelFull), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	default:
+		return fmt.Errorf("%w: %w", client.ErrDisconnected, err)
+	}
 }
 
-func NewAsyncQueue() (client.EventQueue, error) {
+func closeAll(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
+
+func closeFds(readFd, writeFd int) {
+	_ = unix.Close(readFd)
+	if writeFd != readFd {
+		_ = unix.Close(writeFd)
+	}
+}
+
+func NewAsyncQueue(opts ...QueueOption) (client.EventQueue, error) {
 	queue, queueErr := NewFdQueue()
 	if queueErr != nil {
 		return nil, queueErr
 	}
 
+	options := queueOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	q := &AsyncQueue{
-		queue:     queue,
-		eventsCh:  make(chan *client.Event),
-		instances: make(map[string]Communicator),
-		fd2Id:     make(map[int]string),
+		queue:      queue,
+		options:    options,
+		eventsCh:   make(chan *client.Event),
+		instances:  make(map[string]Communicator),
+		fd2Id:      make(map[int]string),
+		writeFd2Id: make(map[int]string),
+		listeners:  make(map[int]*ListenConfig),
+		done:       make(chan struct{}),
 	}
-	if comm, err := q.registerCommunicator(cManagementEndpoint, client.CommunicationConfig{
+	pipe, pipeErr := buildCommunication(client.CommunicationConfig{
 		Type: client.Pipe,
-	}); err != nil {
-		q.Close()
+	})
+	if pipeErr != nil {
+		queue.Close()
+		return nil, pipeErr
+	}
+	readFd, writeFd, estErr := pipe.Establish()
+	if estErr != nil {
+		queue.Close()
+		return nil, estErr
+	}
+	if comm, err := q.registerCommunicator(cManagementEndpoint, readFd, writeFd); err != nil {
+		queue.Close()
 		return nil, err
 	} else {
 		q.managementComm = comm
@@ -150,19 +482,35 @@ func NewAsyncQueue() (client.EventQueue, error) {
 				continue
 			}
 
-			for fd := range fds {
+			for fd, ready := range fds {
+				if ready&writable != 0 {
+					if id, idOk := q.writeFd2Id[fd]; idOk {
+						if comm, commOk := q.instances[id]; commOk {
+							comm.Writable()
+						}
+					}
+				}
+				if ready&readable == 0 {
+					continue
+				}
+				if listen, listenOk := q.listeners[fd]; listenOk {
+					q.accept(listen, fd)
+					continue
+				}
 				if id, idOk := q.fd2Id[fd]; idOk {
 					slog.Debug("new event arrived", "instance", id)
 					if comm, commOk := q.instances[id]; commOk {
 						objects, objectsErr := comm.Read()
 						if objectsErr != nil {
 							slog.Info("connection closed or read failed, removing instance", "instance", id, "error", objectsErr)
-							if delErr := queue.Delete(fd); delErr != nil {
-								slog.Error("could not remove fd from queue", "fd", fd, "error", delErr)
+							if len(objects) > 0 && id != cManagementEndpoint {
+								// what arrived before the connection went still counts
+								q.eventsCh <- &client.Event{
+									Id:   id,
+									Data: objects,
+								}
 							}
-							comm.Close()
-							delete(q.instances, id)
-							delete(q.fd2Id, fd)
+							q.unregisterCommunicator(id)
 							q.eventsCh <- &client.Event{
 								Id:    id,
 								Error: objectsErr,
@@ -173,7 +521,7 @@ func NewAsyncQueue() (client.EventQueue, error) {
 						for _, object := range objects {
 							if id == cManagementEndpoint {
 								var cmd ManagementData
-								if marshalErr := json.Unmarshal([]byte(object), &cmd); marshalErr != nil {
+								if marshalErr := json.Unmarshal(object, &cmd); marshalErr != nil {
 									slog.Error("could not unmarshal event", "instance", id, "error", marshalErr)
 									continue
 								}
@@ -181,7 +529,7 @@ func NewAsyncQueue() (client.EventQueue, error) {
 								case client.ActionAdd:
 									if cmd.Add != nil {
 										action := client.ActionAdd
-										_, communicatoErr := q.registerCommunicator(cmd.Add.Id, cmd.Add.Config)
+										_, communicatoErr := q.registerCommunicator(cmd.Add.Id, cmd.Add.ReadFd, cmd.Add.WriteFd)
 										q.eventsCh <- &client.Event{
 											Id:     cmd.Add.Id,
 											Error:  communicatoErr,
@@ -192,31 +540,65 @@ func NewAsyncQueue() (client.EventQueue, error) {
 									}
 								case client.ActionCancel:
 									if cmd.Cancel != nil {
+										action := client.ActionCancel
 										q.eventsCh <- &client.Event{
-											Id:    cmd.Cancel.Id,
-											Error: ErrRequestCanceled,
+											Id:     cmd.Cancel.Id,
+											Error:  ErrRequestCanceled,
+											Action: &action,
 										}
 									} else {
 										slog.Error("missing cancel config for CANCEL action")
 									}
 								case client.ActionExecute:
 									if cmd.Execute != nil {
-										if comm, commOk := q.instances[cmd.Execute.Id]; commOk {
-											bytes, bytesErr := json.Marshal(cmd.Execute.Request)
-											if bytesErr != nil {
-												slog.Error("could not marshal execute request", "error", bytesErr)
-												continue
-											}
-											writeErr := comm.Write(bytes)
-											if writeErr != nil {
-												slog.Error("could not write execute request", "error", writeErr)
+										if executeErr := q.resync(cmd.Execute); executeErr != nil {
+											slog.Error("could not execute request", "instance", cmd.Execute.Id, "error", executeErr)
+											action := client.ActionExecute
+											q.eventsCh <- &client.Event{
+												Id:     cmd.Execute.Request.Id,
+												Error:  executeErr,
+												Action: &action,
 											}
 										}
 									} else {
 										slog.Error("missing execute config for EXECUTE action")
 									}
+								case client.ActionRemove:
+									if cmd.Remove != nil {
+										if cmd.Remove.Id != cManagementEndpoint && !q.unregisterListener(cmd.Remove.Id) {
+											q.unregisterCommunicator(cmd.Remove.Id)
+										}
+										action := client.ActionRemove
+										q.eventsCh <- &client.Event{
+											Id:     cmd.Remove.Id,
+											Action: &action,
+										}
+									} else {
+										slog.Error("missing remove config for REMOVE action")
+									}
+								case client.ActionListen:
+									if cmd.Listen != nil {
+										action := client.ActionListen
+										listenErr := q.registerListener(cmd.Listen)
+										q.eventsCh <- &client.Event{
+											Id:     cmd.Listen.Id,
+											Error:  listenErr,
+											Action: &action,
+										}
+									} else {
+										slog.Error("missing listen config for LISTEN action")
+									}
 								case client.ActionClose:
+									close(q.done)
 									queue.Close()
+									closed := map[*ListenConfig]struct{}{}
+									for _, listen := range q.listeners {
+										// an endpoint may have several fds
+										if _, done := closed[listen]; !done {
+											closed[listen] = struct{}{}
+											closeListener(listen)
+										}
+									}
 									for _, comm := range q.instances {
 										comm.Close()
 									}
@@ -226,7 +608,7 @@ func NewAsyncQueue() (client.EventQueue, error) {
 								q.eventsCh <- &client.Event{
 									Id:    id,
 									Error: nil,
-									Data:  []string{object},
+									Data:  [][]byte{object},
 								}
 							}
 						}
@@ -0,0 +1,44 @@
+package sockets
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The fds below are created under syscall.ForkLock and marked close-on-exec before
+// it is released, so they never leak into processes started concurrently, e.g. by
+// AddProcess or the application itself.
+
+func cloexecSocket(family, sotype, proto int) (int, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	fd, err := unix.Socket(family, sotype, proto)
+	if err != nil {
+		return -1, err
+	}
+	unix.CloseOnExec(fd)
+	return fd, nil
+}
+
+func cloexecPipe(fds []int) error {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	if err := unix.Pipe(fds); err != nil {
+		return err
+	}
+	unix.CloseOnExec(fds[0])
+	unix.CloseOnExec(fds[1])
+	return nil
+}
+
+func cloexecAccept(fd int) (int, unix.Sockaddr, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	nfd, sa, err := unix.Accept(fd)
+	if err != nil {
+		return -1, nil, err
+	}
+	unix.CloseOnExec(nfd)
+	return nfd, sa, nil
+}
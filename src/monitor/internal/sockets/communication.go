@@ -1,10 +1,19 @@
 package sockets
 
 import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
 	"github.com/q-controller/qapi-client/src/client"
 	"golang.org/x/sys/unix"
 )
 
+const (
+	cDefaultDialTimeout = 5 * time.Second
+)
+
 type Communication interface {
 	Establish() (int, int, error)
 }
@@ -12,9 +21,26 @@ type Communication interface {
 func buildCommunication(c client.CommunicationConfig) (Communication, error) {
 	switch c.Type {
 	case client.UnixDomain:
+		if c.UnixDomain == nil {
+			return nil, client.ErrMissingCommunicationConfig
+		}
 		return &unixDomainCommunication{socketPath: c.UnixDomain.SocketPath}, nil
 	case client.Pipe:
 		return &pipeCommunication{}, nil
+	case client.TCP:
+		if c.TCP == nil {
+			return nil, client.ErrMissingCommunicationConfig
+		}
+		timeout := c.TCP.DialTimeout
+		if timeout <= 0 {
+			timeout = cDefaultDialTimeout
+		}
+		return &tcpCommunication{host: c.TCP.Host, port: c.TCP.Port, timeout: timeout}, nil
+	case client.Process:
+		if c.Process == nil || c.Process.Cmd == nil {
+			return nil, client.ErrMissingCommunicationConfig
+		}
+		return &processCommunication{config: c.Process}, nil
 	default:
 		return nil, client.ErrUnknownCommunicationType
 	}
@@ -25,7 +51,7 @@ type unixDomainCommunication struct {
 }
 
 func (u *unixDomainCommunication) Establish() (int, int, error) {
-	fd, socketErr := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	fd, socketErr := cloexecSocket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
 	if socketErr != nil {
 		return -1, -1, socketErr
 	}
@@ -46,15 +72,132 @@ func (u *unixDomainCommunication) Establish() (int, int, error) {
 	return fd, fd, nil
 }
 
+type tcpCommunication struct {
+	host    string
+	port    int
+	timeout time.Duration
+}
+
+func (t *tcpCommunication) Establish() (int, int, error) {
+	deadline := time.Now().Add(t.timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	addrs, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, t.host)
+	if lookupErr != nil {
+		return -1, -1, lookupErr
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		fd, err := t.dial(addr, time.Until(deadline))
+		if err == nil {
+			return fd, fd, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &net.AddrError{Err: "no addresses found", Addr: t.host}
+	}
+
+	return -1, -1, lastErr
+}
+
+func (t *tcpCommunication) dial(addr net.IPAddr, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		return -1, unix.ETIMEDOUT
+	}
+
+	family, sa := ipSockaddr(addr, t.port)
+	fd, socketErr := cloexecSocket(family, unix.SOCK_STREAM, 0)
+	if socketErr != nil {
+		return -1, socketErr
+	}
+
+	// Set non-blocking, so that the connect can be bounded by the timeout
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	if err := unix.Connect(fd, sa); err != nil {
+		if err != unix.EINPROGRESS {
+			unix.Close(fd)
+			return -1, err
+		}
+		if err := waitConnected(fd, timeout); err != nil {
+			unix.Close(fd)
+			return -1, err
+		}
+	}
+
+	// QMP messages are small, don't let Nagle delay them
+	_ = unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1)
+
+	return fd, nil
+}
+
+// ipSockaddr returns the address family and socket address of addr:port.
+func ipSockaddr(addr net.IPAddr, port int) (int, unix.Sockaddr) {
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa4 := &unix.SockaddrInet4{Port: port}
+		copy(sa4.Addr[:], ip4)
+		return unix.AF_INET, sa4
+	}
+
+	sa6 := &unix.SockaddrInet6{Port: port}
+	copy(sa6.Addr[:], addr.IP.To16())
+	if addr.Zone != "" {
+		if iface, ifaceErr := net.InterfaceByName(addr.Zone); ifaceErr == nil {
+			sa6.ZoneId = uint32(iface.Index)
+		} else if zoneId, zoneErr := strconv.ParseUint(addr.Zone, 10, 32); zoneErr == nil {
+			sa6.ZoneId = uint32(zoneId)
+		}
+	}
+	return unix.AF_INET6, sa6
+}
+
+// waitConnected blocks until a non-blocking connect on fd completes or the timeout expires.
+func waitConnected(fd int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return unix.ETIMEDOUT
+		}
+		pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLOUT}}
+		n, err := unix.Poll(pollFds, int(remaining.Milliseconds())+1)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return err
+		}
+		if n == 0 {
+			return unix.ETIMEDOUT
+		}
+
+		soErr, soErrErr := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
+		if soErrErr != nil {
+			return soErrErr
+		}
+		if soErr != 0 {
+			return unix.Errno(soErr)
+		}
+		return nil
+	}
+}
+
 type pipeCommunication struct{}
 
 func (p *pipeCommunication) Establish() (int, int, error) {
 	fds := make([]int, 2)
-	if pipeErr := unix.Pipe(fds); pipeErr != nil {
+	if pipeErr := cloexecPipe(fds); pipeErr != nil {
 		return -1, -1, pipeErr
 	}
 	for _, fd := range fds {
 		if err := unix.SetNonblock(fd, true); err != nil {
+			closeFds(fds[0], fds[1])
 			return -1, -1, err
 		}
 	}
@@ -0,0 +1,72 @@
+package sockets
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+func TestEstablishSetsCloseOnExec(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "qmp.sock")
+	unixListener, unixErr := net.Listen("unix", socketPath)
+	if unixErr != nil {
+		t.Fatalf("listen: %v", unixErr)
+	}
+	defer unixListener.Close()
+	tcpListener, tcpErr := net.Listen("tcp", "127.0.0.1:0")
+	if tcpErr != nil {
+		t.Fatalf("listen: %v", tcpErr)
+	}
+	defer tcpListener.Close()
+
+	tests := []struct {
+		name   string
+		config client.CommunicationConfig
+	}{
+		{
+			name:   "pipe",
+			config: client.CommunicationConfig{Type: client.Pipe},
+		},
+		{
+			name: "unix domain",
+			config: client.CommunicationConfig{
+				Type:       client.UnixDomain,
+				UnixDomain: &client.UnixDomainConfig{SocketPath: socketPath},
+			},
+		},
+		{
+			name: "tcp",
+			config: client.CommunicationConfig{
+				Type: client.TCP,
+				TCP:  &client.TCPConfig{Host: "127.0.0.1", Port: tcpListener.Addr().(*net.TCPAddr).Port},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comm, commErr := buildCommunication(tt.config)
+			if commErr != nil {
+				t.Fatalf("buildCommunication: %v", commErr)
+			}
+			readFd, writeFd, estErr := comm.Establish()
+			if estErr != nil {
+				t.Fatalf("Establish: %v", estErr)
+			}
+			defer closeFds(readFd, writeFd)
+
+			for _, fd := range []int{readFd, writeFd} {
+				flags, flagsErr := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+				if flagsErr != nil {
+					t.Fatalf("fcntl: %v", flagsErr)
+				}
+				if flags&unix.FD_CLOEXEC == 0 {
+					t.Errorf("fd %d is not close-on-exec", fd)
+				}
+			}
+		})
+	}
+}
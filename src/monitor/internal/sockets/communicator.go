@@ -1,6 +1,7 @@
 package sockets
 
 import (
+	"context"
 	"sync"
 
 	"golang.org/x/sys/unix"
@@ -12,7 +13,7 @@ type fdCommunicator struct {
 	once sync.Once
 }
 
-func (c *fdCommunicator) Read() ([]string, error) {
+func (c *fdCommunicator) Read() ([][]byte, error) {
 	return c.fdReader.Read()
 }
 
@@ -20,8 +21,34 @@ func (c *fdCommunicator) Write(data []byte) error {
 	return c.fdWriter.Write(data)
 }
 
+func (c *fdCommunicator) WriteWithRights(data []byte, fds []int) error {
+	return c.fdWriter.WriteWithRights(data, fds)
+}
+
+func (c *fdCommunicator) WriteContext(ctx context.Context, data []byte, fds []int) error {
+	return c.fdWriter.WriteContext(ctx, data, fds)
+}
+
+func (c *fdCommunicator) WriteAsync(data []byte, fds []int, done func(error)) error {
+	return c.fdWriter.WriteAsync(data, fds, done)
+}
+
+func (c *fdCommunicator) WriteAsyncContext(ctx context.Context, data []byte, fds []int, done func(error)) error {
+	return c.fdWriter.WriteAsyncContext(ctx, data, fds, done)
+}
+
+func (c *fdCommunicator) Writable() {
+	c.fdWriter.Writable()
+}
+
+func (c *fdCommunicator) Resync() {
+	c.fdReader.Resync()
+}
+
 func (c *fdCommunicator) Close() {
 	c.once.Do(func() {
+		// the writer must be done with the fd before it is closed and reused
+		c.fdWriter.Close()
 		_ = unix.Shutdown(c.fdWriter.fd, unix.SHUT_RDWR)
 		_ = unix.Close(c.fdWriter.fd)
 		if c.fdWriter.fd != c.fdReader.fd {
@@ -31,9 +58,9 @@ func (c *fdCommunicator) Close() {
 	})
 }
 
-func newFdCommunicator(readFd, writeFd int) Communicator {
+func newFdCommunicator(readFd, writeFd, writeQueueDepth int) Communicator {
 	return &fdCommunicator{
 		fdReader: &fdReader{fd: readFd},
-		fdWriter: newWriter(writeFd),
+		fdWriter: newWriter(writeFd, writeQueueDepth),
 	}
 }
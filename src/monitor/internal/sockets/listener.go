@@ -0,0 +1,123 @@
+package sockets
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cListenBacklog = 16
+)
+
+// listenSocket binds non-blocking sockets to the endpoint described by config and
+// starts listening on them. QEMU then connects with -qmp unix:/path,server=off. A
+// host name is listened on at every address it resolves to, except for those of a
+// family the host lacks, e.g. ::1 without IPv6.
+func listenSocket(config client.CommunicationConfig) ([]int, error) {
+	switch config.Type {
+	case client.UnixDomain:
+		if config.UnixDomain == nil {
+			return nil, client.ErrMissingCommunicationConfig
+		}
+		fd, err := bindAndListen(unix.AF_UNIX, &unix.SockaddrUnix{Name: config.UnixDomain.SocketPath})
+		if err != nil {
+			return nil, err
+		}
+		return []int{fd}, nil
+	case client.TCP:
+		if config.TCP == nil {
+			return nil, client.ErrMissingCommunicationConfig
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cDefaultDialTimeout)
+		defer cancel()
+		addrs, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, config.TCP.Host)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if len(addrs) == 0 {
+			return nil, &net.AddrError{Err: "no addresses found", Addr: config.TCP.Host}
+		}
+		fds := make([]int, 0, len(addrs))
+		var unavailableErr error
+		for _, addr := range addrs {
+			family, sa := ipSockaddr(addr, config.TCP.Port)
+			fd, err := bindAndListen(family, sa)
+			if errors.Is(err, unix.EAFNOSUPPORT) || errors.Is(err, unix.EADDRNOTAVAIL) {
+				unavailableErr = err
+				continue
+			}
+			if err != nil {
+				closeAll(fds)
+				return nil, err
+			}
+			fds = append(fds, fd)
+		}
+		if len(fds) == 0 {
+			return nil, unavailableErr
+		}
+		return fds, nil
+	default:
+		return nil, client.ErrUnknownCommunicationType
+	}
+}
+
+func bindAndListen(family int, sa unix.Sockaddr) (int, error) {
+	fd, socketErr := cloexecSocket(family, unix.SOCK_STREAM, 0)
+	if socketErr != nil {
+		return -1, socketErr
+	}
+
+	if family != unix.AF_UNIX {
+		_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+	}
+	if family == unix.AF_INET6 {
+		// leaves the IPv4 addresses of a dual-stack host to their own socket
+		_ = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 1)
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if err := unix.Listen(fd, cListenBacklog); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+
+	return fd, nil
+}
+
+// acceptConnection accepts a pending connection on the listening fd. It returns
+// unix.EAGAIN once there are none left.
+func acceptConnection(fd int) (int, string, error) {
+	nfd, sa, acceptErr := cloexecAccept(fd)
+	if acceptErr != nil {
+		return -1, "", acceptErr
+	}
+	if err := unix.SetNonblock(nfd, true); err != nil {
+		unix.Close(nfd)
+		return -1, "", err
+	}
+
+	var remote string
+	switch addr := sa.(type) {
+	case *unix.SockaddrInet4:
+		remote = net.JoinHostPort(net.IP(addr.Addr[:]).String(), strconv.Itoa(addr.Port))
+		_ = unix.SetsockoptInt(nfd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1)
+	case *unix.SockaddrInet6:
+		remote = net.JoinHostPort(net.IP(addr.Addr[:]).String(), strconv.Itoa(addr.Port))
+		_ = unix.SetsockoptInt(nfd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1)
+	case *unix.SockaddrUnix:
+		remote = addr.Name
+	}
+
+	return nfd, remote, nil
+}
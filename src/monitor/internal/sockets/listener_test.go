@@ -0,0 +1,59 @@
+package sockets
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+func TestListenSocketBindsEveryAddress(t *testing.T) {
+	want := []string{"127.0.0.1"}
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		ln.Close()
+		if addrs, _ := net.LookupHost("localhost"); slices.Contains(addrs, "::1") {
+			want = append(want, "::1")
+		}
+	}
+
+	free, freeErr := net.Listen("tcp", "127.0.0.1:0")
+	if freeErr != nil {
+		t.Fatalf("listen: %v", freeErr)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	fds, listenErr := listenSocket(client.CommunicationConfig{
+		Type: client.TCP,
+		TCP:  &client.TCPConfig{Host: "localhost", Port: port},
+	})
+	if listenErr != nil {
+		t.Fatalf("listenSocket: %v", listenErr)
+	}
+	defer closeAll(fds)
+
+	var got []string
+	for _, fd := range fds {
+		switch sa := getsockname(fd).(type) {
+		case *unix.SockaddrInet4:
+			got = append(got, net.IP(sa.Addr[:]).String())
+		case *unix.SockaddrInet6:
+			got = append(got, net.IP(sa.Addr[:]).String())
+		}
+	}
+	for _, addr := range want {
+		if !slices.Contains(got, addr) {
+			t.Errorf("listening on %v, not on %s", got, addr)
+			continue
+		}
+		conn, dialErr := net.Dial("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+		if dialErr != nil {
+			t.Errorf("dial %s: %v", addr, dialErr)
+			continue
+		}
+		conn.Close()
+	}
+}
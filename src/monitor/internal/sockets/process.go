@@ -0,0 +1,59 @@
+package sockets
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+// processCommunication talks to a child's stdin and stdout, e.g. QEMU run with -qmp stdio.
+type processCommunication struct {
+	config *client.ProcessConfig
+}
+
+func (p *processCommunication) Establish() (int, int, error) {
+	readFd, writeFd, err := startProcess(p.config.Cmd)
+	if err == nil && p.config.Started != nil {
+		p.config.Started(p.config.Cmd.Process)
+	}
+	return readFd, writeFd, err
+}
+
+// startProcess starts cmd with pipes for its stdin and stdout and returns the
+// parent's ends of them: the one to read the child's stdout from and the one to
+// write to its stdin.
+func startProcess(cmd *exec.Cmd) (int, int, error) {
+	var stdin, stdout [2]int
+	if err := cloexecPipe(stdin[:]); err != nil {
+		return -1, -1, err
+	}
+	if err := cloexecPipe(stdout[:]); err != nil {
+		closeFds(stdin[0], stdin[1])
+		return -1, -1, err
+	}
+
+	childStdin := os.NewFile(uintptr(stdin[0]), "stdin")
+	childStdout := os.NewFile(uintptr(stdout[1]), "stdout")
+	cmd.Stdin = childStdin
+	cmd.Stdout = childStdout
+	startErr := cmd.Start()
+	// the child has its own copies now
+	childStdin.Close()
+	childStdout.Close()
+	if startErr != nil {
+		closeFds(stdin[1], stdout[0])
+		return -1, -1, startErr
+	}
+
+	for _, fd := range []int{stdout[0], stdin[1]} {
+		if err := unix.SetNonblock(fd, true); err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			closeFds(stdin[1], stdout[0])
+			return -1, -1, err
+		}
+	}
+	return stdout[0], stdin[1], nil
+}
@@ -6,23 +6,31 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// readiness tells what an fd in the queue is ready for.
+type readiness uint8
+
+const (
+	readable readiness = 1 << iota
+	writable
+)
+
 type fdQueue struct {
 	fd int
 }
 
-func (q *fdQueue) Wait() (iter.Seq[int], error) {
+func (q *fdQueue) Wait() (iter.Seq2[int, readiness], error) {
 	fds, fdsErr := q.waitInternal()
 	if fdsErr != nil {
 		return nil, fdsErr
 	}
 
-	return func(yield func(int) bool) {
+	return func(yield func(int, readiness) bool) {
 		if fds == nil {
 			return
 		}
 
-		for fd := range fds {
-			if !yield(fd) {
+		for fd, ready := range fds {
+			if !yield(fd, ready) {
 				return
 			}
 		}
@@ -33,8 +41,10 @@ func (q *fdQueue) Close() error {
 	return unix.Close(q.fd)
 }
 
-func (q *fdQueue) Add(fd int) error {
-	return q.addInternal(fd)
+// Add watches fd for the readiness in interest. Readiness is edge-triggered for
+// writable: it is reported when the fd drains, not whenever it has room.
+func (q *fdQueue) Add(fd int, interest readiness) error {
+	return q.addInternal(fd, interest)
 }
 
 func (q *fdQueue) Delete(fd int) error {
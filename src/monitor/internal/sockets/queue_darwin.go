@@ -1,13 +1,14 @@
 package sockets
 
 import (
+	"errors"
 	"fmt"
 	"iter"
 
 	"golang.org/x/sys/unix"
 )
 
-func (q *fdQueue) waitInternal() (iter.Seq[int], error) {
+func (q *fdQueue) waitInternal() (iter.Seq2[int, readiness], error) {
 	events := make([]unix.Kevent_t, 10)
 	n, err := unix.Kevent(q.fd, nil, events, nil) // Block until events occur
 	if err != nil {
@@ -17,24 +18,38 @@ func (q *fdQueue) waitInternal() (iter.Seq[int], error) {
 		return nil, err
 	}
 
-	return func(yield func(int) bool) {
+	return func(yield func(int, readiness) bool) {
 		for i := range n {
-			fd := int(events[i].Ident)
-			if !yield(fd) {
+			ready := readable
+			if events[i].Filter == unix.EVFILT_WRITE {
+				ready = writable
+			}
+			if !yield(int(events[i].Ident), ready) {
 				return
 			}
 		}
 	}, nil
 }
 
-func (q *fdQueue) addInternal(fd int) error {
-	event := unix.Kevent_t{
-		Ident:  uint64(fd),
-		Filter: unix.EVFILT_READ,
-		Flags:  unix.EV_ADD | unix.EV_ENABLE,
+func (q *fdQueue) addInternal(fd int, interest readiness) error {
+	var changes []unix.Kevent_t
+	if interest&readable != 0 {
+		changes = append(changes, unix.Kevent_t{
+			Ident:  uint64(fd),
+			Filter: unix.EVFILT_READ,
+			Flags:  unix.EV_ADD | unix.EV_ENABLE,
+		})
+	}
+	if interest&writable != 0 {
+		// EV_CLEAR reports the fd draining once, like EPOLLET
+		changes = append(changes, unix.Kevent_t{
+			Ident:  uint64(fd),
+			Filter: unix.EVFILT_WRITE,
+			Flags:  unix.EV_ADD | unix.EV_ENABLE | unix.EV_CLEAR,
+		})
 	}
 
-	if _, err := unix.Kevent(q.fd, []unix.Kevent_t{event}, nil, nil); err != nil {
+	if _, err := unix.Kevent(q.fd, changes, nil, nil); err != nil {
 		return fmt.Errorf("kevent add failed: %v", err)
 	}
 
@@ -42,13 +57,25 @@ func (q *fdQueue) addInternal(fd int) error {
 }
 
 func (q *fdQueue) deleteInternal(fd int) error {
-	event := unix.Kevent_t{
-		Ident:  uint64(fd),
-		Filter: unix.EVFILT_READ,
-		Flags:  unix.EV_DELETE,
+	var deleted bool
+	var deleteErr error
+	for _, filter := range []int16{unix.EVFILT_READ, unix.EVFILT_WRITE} {
+		event := unix.Kevent_t{
+			Ident:  uint64(fd),
+			Filter: filter,
+			Flags:  unix.EV_DELETE,
+		}
+		// the fd need not be watched with both filters
+		if _, err := unix.Kevent(q.fd, []unix.Kevent_t{event}, nil, nil); err == nil {
+			deleted = true
+		} else if !errors.Is(err, unix.ENOENT) {
+			deleteErr = err
+		}
+	}
+	if !deleted && deleteErr == nil {
+		return unix.ENOENT
 	}
-	_, err := unix.Kevent(q.fd, []unix.Kevent_t{event}, nil, nil)
-	return err
+	return deleteErr
 }
 
 func createQueueFd() (int, error) {
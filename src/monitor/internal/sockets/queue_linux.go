@@ -6,7 +6,7 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func (q *fdQueue) waitInternal() (iter.Seq[int], error) {
+func (q *fdQueue) waitInternal() (iter.Seq2[int, readiness], error) {
 	events := make([]unix.EpollEvent, 10)
 	n, err := unix.EpollWait(q.fd, events, -1) // Block until events occur
 	if err != nil {
@@ -17,21 +17,34 @@ func (q *fdQueue) waitInternal() (iter.Seq[int], error) {
 		return nil, err
 	}
 
-	return func(yield func(int) bool) {
+	return func(yield func(int, readiness) bool) {
 		for i := range n {
-			fd := int(events[i].Fd)
-			if !yield(fd) {
+			var ready readiness
+			if events[i].Events&(unix.EPOLLIN|unix.EPOLLHUP|unix.EPOLLERR) != 0 {
+				ready |= readable
+			}
+			// a pending write has to learn about the error too
+			if events[i].Events&(unix.EPOLLOUT|unix.EPOLLHUP|unix.EPOLLERR) != 0 {
+				ready |= writable
+			}
+			if !yield(int(events[i].Fd), ready) {
 				return
 			}
 		}
 	}, nil
 }
 
-func (q *fdQueue) addInternal(fd int) error {
+func (q *fdQueue) addInternal(fd int, interest readiness) error {
 	event := unix.EpollEvent{
-		Events: unix.EPOLLIN | unix.EPOLLET,
+		Events: unix.EPOLLET,
 		Fd:     int32(fd),
 	}
+	if interest&readable != 0 {
+		event.Events |= unix.EPOLLIN
+	}
+	if interest&writable != 0 {
+		event.Events |= unix.EPOLLOUT
+	}
 
 	if err := unix.EpollCtl(q.fd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
 		return err
@@ -45,5 +58,5 @@ func (q *fdQueue) deleteInternal(fd int) error {
 }
 
 func createQueueFd() (int, error) {
-	return unix.EpollCreate1(0)
+	return unix.EpollCreate1(unix.EPOLL_CLOEXEC)
 }
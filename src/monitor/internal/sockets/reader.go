@@ -2,49 +2,46 @@ package sockets
 
 import (
 	"io"
-	"strings"
 
 	"github.com/q-controller/qapi-client/src/utils"
 	"golang.org/x/sys/unix"
 )
 
 type fdReader struct {
-	fd         int
-	dataBuffer strings.Builder
+	fd     int
+	framer utils.Framer
 }
 
-func (r *fdReader) Read() ([]string, error) {
-	var readErr error = nil
-	temp := make([]byte, 1024) // Temporary buffer for reading
+// Resync drops buffered input and makes Read discard data up to the next sentinel.
+func (r *fdReader) Resync() {
+	r.framer.Resync()
+}
+
+func (r *fdReader) Read() ([][]byte, error) {
+	var messages [][]byte
+	temp := utils.GetBuffer()
+	defer utils.PutBuffer(temp)
+	chunk := (*temp)[:cap(*temp)]
 
 	for {
-		n, err := unix.Read(r.fd, temp)
+		n, err := unix.Read(r.fd, chunk)
 		if n > 0 {
-			// Append the read data to the buffer
-			r.dataBuffer.Write(temp[:n])
+			messages = append(messages, r.framer.Feed(chunk[:n])...)
+			continue
 		}
-		if err != nil {
-			if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
-				// No more data available; return accumulated data
-				break
-			}
-			// Return accumulated data (if any) and the error
-			readErr = err
+		if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+			// No more data available; return what is complete so far
+			return messages, nil
 		}
-		if n == 0 {
-			// EOF (connection closed)
-			return nil, io.EOF
+		if err == unix.EINTR {
+			continue
 		}
+		if err != nil {
+			// Return complete messages (if any) and the error
+			return messages, err
+		}
+		// EOF (connection closed), after the last replies
+		r.framer.Reset()
+		return messages, io.EOF
 	}
-
-	// Parse complete JSON objects from the buffer
-	jsonStrings, remaining, _ := utils.ParseJSONObjects(r.dataBuffer.String())
-
-	// Reset buffer and store any remaining unparsed data
-	r.dataBuffer.Reset()
-	if remaining != "" {
-		r.dataBuffer.WriteString(remaining)
-	}
-
-	return jsonStrings, readErr
 }
@@ -1,30 +1,68 @@
 package sockets
 
-import "github.com/q-controller/qapi-client/src/client"
+import (
+	"context"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
 
 type Reader interface {
-	Read() ([]string, error)
+	Read() ([][]byte, error)
 }
 
+// Writer queues writes for a goroutine that waits for the fd to drain whenever it
+// is full. Write and WriteWithRights block while the queue is full.
 type Writer interface {
 	Write([]byte) error
+	// WriteWithRights passes fds as SCM_RIGHTS ancillary data with the first bytes
+	// written; only Unix domain sockets support it.
+	WriteWithRights(data []byte, fds []int) error
+	// WriteContext is WriteWithRights giving up on a full queue once ctx ends.
+	WriteContext(ctx context.Context, data []byte, fds []int) error
+	// WriteAsync queues data without waiting for it to be written and fails with
+	// ErrWriterChannelFull if the queue is full. done gets the outcome; data must
+	// not be modified until then.
+	WriteAsync(data []byte, fds []int, done func(error)) error
+	// WriteAsyncContext is WriteAsync waiting for room in a full queue until ctx
+	// ends.
+	WriteAsyncContext(ctx context.Context, data []byte, fds []int, done func(error)) error
+	// Writable tells the writer the fd drained.
+	Writable()
 }
 
 type Communicator interface {
 	Reader
 	Writer
+	// Resync discards everything read until the next 0xFF sentinel byte.
+	Resync()
 	Close()
 }
 
+// AddConfig hands an already established connection over to the event loop.
 type AddConfig struct {
-	Id     string                     `json:"id"`
-	Config client.CommunicationConfig `json:"config"`
+	Id      string `json:"id"`
+	ReadFd  int    `json:"read_fd"`
+	WriteFd int    `json:"write_fd"`
 }
 
 type CancelConfig struct {
 	Id string `json:"id"`
 }
 
+// ListenConfig hands the listening sockets of an endpoint over to the event loop.
+type ListenConfig struct {
+	Id  string `json:"id"`
+	Fds []int  `json:"fds"`
+	// SocketPath is unlinked when a Unix domain listener is closed
+	SocketPath string `json:"socket_path,omitempty"`
+}
+
+type RemoveConfig struct {
+	Id string `json:"id"`
+}
+
+// ExecuteConfig has the event loop resynchronize the connection and write Request
+// behind a sentinel; other requests are queued by the caller.
 type ExecuteConfig struct {
 	Id      string         `json:"id"`
 	Request client.Request `json:"request"`
@@ -35,4 +73,6 @@ type ManagementData struct {
 	Add     *AddConfig     `json:"add,omitempty"`
 	Cancel  *CancelConfig  `json:"cancel,omitempty"`
 	Execute *ExecuteConfig `json:"execute,omitempty"`
+	Remove  *RemoveConfig  `json:"remove,omitempty"`
+	Listen  *ListenConfig  `json:"listen,omitempty"`
 }
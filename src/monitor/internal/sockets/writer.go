@@ -1,77 +1,216 @@
 package sockets
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"time"
+	"sync"
 
+	"github.com/q-controller/qapi-client/src/client"
 	"golang.org/x/sys/unix"
 )
 
-var ErrWriterChannelFull = fmt.Errorf("writer channel full")
+const cDefaultWriteQueueDepth = 100
+
+var ErrWriterChannelFull = client.ErrQueueFull
 var ErrIncompleteWrite = fmt.Errorf("incomplete write")
 var ErrSocketClosed = fmt.Errorf("socket closed")
 var ErrWriterClosed = fmt.Errorf("writer closed")
+var ErrRightsUnsupported = fmt.Errorf("passing file descriptors requires a Unix domain socket")
 
 type WriterRequest struct {
 	Data []byte
-	Done chan error
+	Fds  []int
+	// Done is called from the writer goroutine once the request is written or failed
+	Done func(error)
 }
 
 type fdWriter struct {
-	ch   chan *WriterRequest
-	fd   int
-	done chan struct{}
+	ch chan *WriterRequest
+	fd int
+	// writable is signaled by the event loop when the fd drains
+	writable  chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	// mu keeps requests from being queued once Close drained ch for good
+	mu     sync.RWMutex
+	closed bool
+	// err fails every request once a write failed
+	err error
 }
 
-func newWriter(fd int) *fdWriter {
+func newWriter(fd int, depth int) *fdWriter {
+	if depth <= 0 {
+		depth = cDefaultWriteQueueDepth
+	}
 	w := &fdWriter{
-		ch:   make(chan *WriterRequest, 100),
-		fd:   fd,
-		done: make(chan struct{}),
+		ch:       make(chan *WriterRequest, depth),
+		fd:       fd,
+		writable: make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 	go w.run()
 	return w
 }
 
 func (w *fdWriter) run() {
-OuterLoop:
-	for req := range w.ch {
-		payload := req.Data
-		totalSent := 0
-		for totalSent < len(payload) {
-			n, err := unix.Write(w.fd, payload[totalSent:])
-			if err != nil {
-				if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
-					// Write buffer full; retry after a short delay
-					time.Sleep(10 * time.Millisecond)
+	defer close(w.done)
+	for {
+		select {
+		case <-w.closing:
+			return
+		case req := <-w.ch:
+			if w.err != nil {
+				req.Done(w.err)
+				continue
+			}
+			err := w.write(req)
+			if err != nil && !errors.Is(err, ErrRightsUnsupported) {
+				w.err = err
+			}
+			req.Done(err)
+		}
+	}
+}
+
+func (w *fdWriter) write(req *WriterRequest) error {
+	payload := req.Data
+	if len(req.Fds) > 0 {
+		if _, isUnix := getsockname(w.fd).(*unix.SockaddrUnix); !isUnix {
+			return ErrRightsUnsupported
+		}
+	}
+	for totalSent := 0; totalSent < len(payload); {
+		var n int
+		var err error
+		if totalSent == 0 && len(req.Fds) > 0 {
+			// the rights travel with the first byte that makes it out
+			n, err = unix.SendmsgN(w.fd, payload, unix.UnixRights(req.Fds...), nil, 0)
+		} else {
+			n, err = unix.Write(w.fd, payload[totalSent:])
+		}
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
+				// Write buffer full; the event loop tells when it drains
+				select {
+				case <-w.writable:
 					continue
+				case <-w.closing:
+					return ErrWriterClosed
 				}
-				req.Done <- err
-				break OuterLoop
 			}
-			if n == 0 {
-				req.Done <- ErrSocketClosed
-				break OuterLoop
+			if err == unix.EINTR {
+				continue
 			}
-			totalSent += n
+			return err
 		}
-
-		req.Done <- nil
+		if n == 0 {
+			return ErrSocketClosed
+		}
+		totalSent += n
 	}
+	return nil
+}
 
-	close(w.done)
+func getsockname(fd int) unix.Sockaddr {
+	sa, _ := unix.Getsockname(fd)
+	return sa
+}
+
+// Writable wakes a write waiting for the fd to drain.
+func (w *fdWriter) Writable() {
+	select {
+	case w.writable <- struct{}{}:
+	default:
+	}
 }
 
 func (w *fdWriter) Write(buf []byte) error {
+	return w.WriteContext(context.Background(), buf, nil)
+}
+
+func (w *fdWriter) WriteWithRights(buf []byte, fds []int) error {
+	return w.WriteContext(context.Background(), buf, fds)
+}
+
+func (w *fdWriter) WriteContext(ctx context.Context, buf []byte, fds []int) error {
 	b := make([]byte, len(buf))
 	copy(b, buf)
 	done := make(chan error, 1)
+	req := &WriterRequest{Data: b, Fds: fds, Done: func(err error) {
+		done <- err
+	}}
+	if err := w.enqueue(ctx, req); err != nil {
+		return err
+	}
+
 	select {
+	case err := <-done:
+		return err
 	case <-w.done:
+		// the writer may have failed the request on its way out
+		select {
+		case err := <-done:
+			return err
+		default:
+			return ErrWriterClosed
+		}
+	}
+}
+
+func (w *fdWriter) WriteAsync(buf []byte, fds []int, done func(error)) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
 		return ErrWriterClosed
-	case w.ch <- &WriterRequest{Data: b, Done: done}:
-		return <-done
+	}
+	select {
+	case w.ch <- &WriterRequest{Data: buf, Fds: fds, Done: done}:
+		return nil
 	default:
 		return ErrWriterChannelFull
 	}
 }
+
+func (w *fdWriter) WriteAsyncContext(ctx context.Context, buf []byte, fds []int, done func(error)) error {
+	return w.enqueue(ctx, &WriterRequest{Data: buf, Fds: fds, Done: done})
+}
+
+// enqueue waits for room in the queue until ctx ends or the writer is closed.
+func (w *fdWriter) enqueue(ctx context.Context, req *WriterRequest) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	select {
+	case w.ch <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.closing:
+		return ErrWriterClosed
+	}
+}
+
+// Close stops the writer, failing the requests still queued, and waits for it to exit.
+func (w *fdWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.closing)
+	})
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for {
+		select {
+		case req := <-w.ch:
+			req.Done(ErrWriterClosed)
+		default:
+			return
+		}
+	}
+}
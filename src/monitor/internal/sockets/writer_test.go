@@ -0,0 +1,202 @@
+package sockets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func sameFile(t *testing.T, a, b int) bool {
+	t.Helper()
+	var statA, statB unix.Stat_t
+	if err := unix.Fstat(a, &statA); err != nil {
+		t.Fatalf("fstat: %v", err)
+	}
+	if err := unix.Fstat(b, &statB); err != nil {
+		t.Fatalf("fstat: %v", err)
+	}
+	return statA.Dev == statB.Dev && statA.Ino == statB.Ino
+}
+
+func TestWriterPassesRights(t *testing.T) {
+	pair, pairErr := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if pairErr != nil {
+		t.Fatalf("socketpair: %v", pairErr)
+	}
+	comm := newFdCommunicator(pair[0], pair[0], 0)
+	defer comm.Close()
+	defer unix.Close(pair[1])
+
+	file, fileErr := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	if fileErr != nil {
+		t.Fatalf("create: %v", fileErr)
+	}
+	defer file.Close()
+	fd, dupErr := unix.Dup(int(file.Fd()))
+	if dupErr != nil {
+		t.Fatalf("dup: %v", dupErr)
+	}
+	defer unix.Close(fd)
+
+	request := []byte(`{"execute": "getfd", "arguments": {"fdname": "disk"}}`)
+	if err := comm.WriteWithRights(request, []int{fd}); err != nil {
+		t.Fatalf("WriteWithRights: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, recvErr := unix.Recvmsg(pair[1], buf, oob, 0)
+	if recvErr != nil {
+		t.Fatalf("recvmsg: %v", recvErr)
+	}
+	if string(buf[:n]) != string(request) {
+		t.Errorf("data = %q, want %q", buf[:n], request)
+	}
+
+	messages, msgErr := unix.ParseSocketControlMessage(oob[:oobn])
+	if msgErr != nil || len(messages) != 1 {
+		t.Fatalf("control messages = %v, %v", messages, msgErr)
+	}
+	fds, rightsErr := unix.ParseUnixRights(&messages[0])
+	if rightsErr != nil || len(fds) != 1 {
+		t.Fatalf("rights = %v, %v", fds, rightsErr)
+	}
+	defer unix.Close(fds[0])
+	if !sameFile(t, fds[0], int(file.Fd())) {
+		t.Error("received descriptor refers to another file")
+	}
+
+	// plain writes keep working afterwards
+	if err := comm.Write([]byte("{}")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func TestWriterRightsRequireUnixSocket(t *testing.T) {
+	var pipe [2]int
+	if err := unix.Pipe(pipe[:]); err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	comm := newFdCommunicator(pipe[0], pipe[1], 0)
+	defer comm.Close()
+
+	if err := comm.WriteWithRights([]byte("{}"), []int{pipe[0]}); !errors.Is(err, ErrRightsUnsupported) {
+		t.Fatalf("WriteWithRights error = %v, want %v", err, ErrRightsUnsupported)
+	}
+	if err := comm.Write([]byte("{}")); err != nil {
+		t.Fatalf("Write after rejected rights: %v", err)
+	}
+}
+
+// nonblockingPair returns a connected socket pair whose first end is non-blocking
+// and has a small send buffer, so that large writes hit EAGAIN.
+func nonblockingPair(t *testing.T) [2]int {
+	t.Helper()
+	pair, pairErr := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if pairErr != nil {
+		t.Fatalf("socketpair: %v", pairErr)
+	}
+	if err := unix.SetNonblock(pair[0], true); err != nil {
+		t.Fatalf("set nonblock: %v", err)
+	}
+	_ = unix.SetsockoptInt(pair[0], unix.SOL_SOCKET, unix.SO_SNDBUF, 4096)
+	t.Cleanup(func() { unix.Close(pair[1]) })
+	return pair
+}
+
+func TestWriterWaitsForWritable(t *testing.T) {
+	pair := nonblockingPair(t)
+	queue, queueErr := NewFdQueue()
+	if queueErr != nil {
+		t.Fatalf("NewFdQueue: %v", queueErr)
+	}
+	defer queue.Close()
+	if err := queue.Add(pair[0], writable); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	comm := newFdCommunicator(pair[0], pair[0], 0)
+	defer comm.Close()
+
+	go func() {
+		for {
+			fds, err := queue.Wait()
+			if err != nil {
+				return
+			}
+			for fd, ready := range fds {
+				if fd == pair[0] && ready&writable != 0 {
+					comm.Writable()
+				}
+			}
+		}
+	}()
+
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	done := make(chan error, 1)
+	if err := comm.WriteAsync(payload, nil, func(err error) { done <- err }); err != nil {
+		t.Fatalf("WriteAsync: %v", err)
+	}
+
+	buf := make([]byte, 64<<10)
+	for received := 0; received < len(payload); {
+		n, readErr := unix.Read(pair[1], buf)
+		if readErr != nil || n == 0 {
+			t.Fatalf("read after %d bytes: %v", received, readErr)
+		}
+		received += n
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write did not complete")
+	}
+}
+
+func TestWriterQueueDepth(t *testing.T) {
+	pair := nonblockingPair(t)
+	// nobody reads pair[1] or reports the fd writable, so the first write stalls
+	comm := newFdCommunicator(pair[0], pair[0], 1)
+
+	results := make(chan error, 2)
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	if err := comm.WriteAsync(payload, nil, func(err error) { results <- err }); err != nil {
+		t.Fatalf("first WriteAsync: %v", err)
+	}
+	// the writer stalls on the first write, leaving room for one more, once its
+	// first bytes reach the peer
+	fds := []unix.PollFd{{Fd: int32(pair[1]), Events: unix.POLLIN}}
+	if n, err := unix.Poll(fds, 5000); err != nil || n == 0 {
+		t.Fatalf("first write did not start: %v", err)
+	}
+	if err := comm.WriteAsync([]byte("{}"), nil, func(err error) { results <- err }); err != nil {
+		t.Fatalf("second WriteAsync: %v", err)
+	}
+	if err := comm.WriteAsync([]byte("{}"), nil, func(err error) { results <- err }); !errors.Is(err, ErrWriterChannelFull) {
+		t.Fatalf("WriteAsync on a full queue = %v, want %v", err, ErrWriterChannelFull)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := comm.WriteContext(ctx, []byte("{}"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WriteContext error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	comm.Close()
+	for range 2 {
+		if err := <-results; !errors.Is(err, ErrWriterClosed) {
+			t.Errorf("queued write error = %v, want %v", err, ErrWriterClosed)
+		}
+	}
+	if err := comm.Write([]byte("{}")); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Write after Close = %v, want %v", err, ErrWriterClosed)
+	}
+}
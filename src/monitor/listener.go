@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+var ErrListenerExists = fmt.Errorf("listener already exists")
+
+// Naming picks the name of the instance for a connection accepted by a listener.
+// name is unique, the listener's name followed by a sequence number, e.g. "vms-1";
+// remote is the peer's address, usually empty for Unix domain sockets. Returning
+// name keeps it, returning "" refuses the connection, as does returning the name
+// of an existing instance. It runs in a goroutine of its own for every connection.
+type Naming func(name, remote string) string
+
+// listener is a socket the Monitor accepts QEMU-initiated connections on.
+type listener struct {
+	config  client.CommunicationConfig
+	options addOptions
+	naming  Naming
+	// accepted numbers the connections accepted so far
+	accepted uint64
+}
+
+// Listen binds to a Unix domain socket and accepts connections that QEMU initiates
+// with -qmp unix:/path,server=off. Each connection becomes an instance, named by naming
+// if it is not nil, reported with InstanceMessageAdd once negotiated; opts apply to every such instance,
+// except WithReconnect since QEMU reconnects by itself (reconnect-ms). The returned
+// channel resolves once the socket is listening, or with ErrListenerExists if name is
+// taken. Remove stops listening and removes the socket file; instances accepted so
+// far stay connected.
+func (m *Monitor) Listen(name, socketPath string, naming Naming, opts ...AddOption) <-chan error {
+	return m.listen(name, client.CommunicationConfig{
+		Type: client.UnixDomain,
+		UnixDomain: &client.UnixDomainConfig{
+			SocketPath: socketPath,
+		},
+	}, naming, opts)
+}
+
+// ListenTCP is Listen for QEMU connecting with -qmp tcp:host:port,server=off. A host
+// name is listened on at each address it resolves to.
+func (m *Monitor) ListenTCP(name string, config client.TCPConfig, naming Naming, opts ...AddOption) <-chan error {
+	return m.listen(name, client.CommunicationConfig{
+		Type: client.TCP,
+		TCP:  &config,
+	}, naming, opts)
+}
+
+func (m *Monitor) listen(name string, config client.CommunicationConfig, naming Naming, opts []AddOption) <-chan error {
+	options := newAddOptions(opts)
+	options.reconnect = nil
+
+	m.mu.Lock()
+	_, exists := m.listeners[name]
+	if _, isInstance := m.instances[name]; isInstance {
+		exists = true
+	}
+	if !exists {
+		m.listeners[name] = &listener{
+			config:  config,
+			options: options,
+			naming:  naming,
+		}
+	}
+	m.mu.Unlock()
+
+	if exists {
+		resultCh := make(chan error, 1)
+		resultCh <- fmt.Errorf("%w: %q", ErrListenerExists, name)
+		close(resultCh)
+		return resultCh
+	}
+
+	ch := m.listenLoop.Enqueue(name)
+	if err := m.queue.Listen(name, config); err != nil {
+		m.dropListener(name)
+		m.listenLoop.Post(client.Data[error]{
+			Id:      name,
+			Payload: err,
+		})
+	}
+
+	return ch
+}
+
+func (m *Monitor) dropListener(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, exists := m.listeners[name]
+	delete(m.listeners, name)
+	return exists
+}
+
+// accept names a connection the listener accepted and attaches it as a new
+// instance, which is negotiated once the queue reports it added.
+func (m *Monitor) accept(listenerName string, conn *client.Connection) {
+	m.mu.Lock()
+	l, listening := m.listeners[listenerName]
+	var name string
+	if listening {
+		l.accepted++
+		name = fmt.Sprintf("%s-%d", listenerName, l.accepted)
+	}
+	m.mu.Unlock()
+	if listening && l.naming != nil {
+		name = l.naming(name, conn.Remote)
+	}
+
+	m.mu.Lock()
+	_, listening = m.listeners[listenerName]
+	_, exists := m.instances[name]
+	_, isListener := m.listeners[name]
+	var inst *instance
+	if listening && name != "" && !exists && !isListener {
+		inst = newInstance(name, l.config, l.options)
+		m.instances[name] = inst
+	}
+	m.mu.Unlock()
+
+	if inst == nil {
+		slog.Info("refusing connection", "listener", listenerName, "remote", conn.Remote, "instance", name)
+		_ = unix.Close(conn.Fd)
+		return
+	}
+	if err := m.queue.Attach(name, conn.Fd); err != nil {
+		m.failAdd(name, err)
+	}
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+func TestMonitorListen(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "qmp.sock")
+	mon := newTestMonitor(t)
+
+	naming := func(name, remote string) string {
+		if name != "listener-1" {
+			return ""
+		}
+		return "listened-instance"
+	}
+	if err := waitAdd(t, mon.Listen("listener", socketPath, naming)); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if err := waitAdd(t, mon.Listen("listener", socketPath, naming)); !errors.Is(err, ErrListenerExists) {
+		t.Fatalf("second Listen: got %v, want ErrListenerExists", err)
+	}
+
+	// QEMU connecting with -qmp unix:path,server=off
+	conn, dialErr := net.Dial("unix", socketPath)
+	if dialErr != nil {
+		t.Fatalf("dial: %v", dialErr)
+	}
+	go serveQMP(conn, okReply)
+
+	waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == "listened-instance" &&
+			ev.InstanceMessage.InstanceMessageType == InstanceMessageAdd
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := mon.ExecuteContext(ctx, "listened-instance", client.Request{Execute: "query-status"}); err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+
+	// naming refuses the second connection
+	refused, refusedErr := net.Dial("unix", socketPath)
+	if refusedErr != nil {
+		t.Fatalf("dial: %v", refusedErr)
+	}
+	defer refused.Close()
+	refused.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := refused.Read(make([]byte, 1)); err == nil {
+		t.Fatal("refused connection is still open")
+	}
+
+	if err := waitAdd(t, mon.Remove("listener")); err != nil {
+		t.Fatalf("Remove listener: %v", err)
+	}
+	if _, err := os.Stat(socketPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+	if _, err := mon.ExecuteContext(ctx, "listened-instance", client.Request{Execute: "query-status"}); err != nil {
+		t.Errorf("accepted instance lost with the listener: %v", err)
+	}
+}
+
+func TestMonitorListenNamesConnections(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "qmp.sock")
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.Listen("vms", socketPath, nil)); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	for _, want := range []string{"vms-1", "vms-2"} {
+		conn, dialErr := net.Dial("unix", socketPath)
+		if dialErr != nil {
+			t.Fatalf("dial: %v", dialErr)
+		}
+		go serveQMP(conn, okReply)
+
+		waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+			return ev.InstanceMessage != nil &&
+				ev.InstanceMessage.Instance == want &&
+				ev.InstanceMessage.InstanceMessageType == InstanceMessageAdd
+		})
+	}
+}
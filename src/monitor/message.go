@@ -14,11 +14,17 @@ type InstanceMessageType int
 const (
 	InstanceMessageAdd InstanceMessageType = iota
 	InstanceMessageDelete
+	// The connection dropped and the instance's ReconnectPolicy is being applied
+	InstanceMessageReconnecting
+	// The connection was re-established and capabilities negotiated again
+	InstanceMessageReconnected
 )
 
 type InstanceMessage struct {
 	Instance            string
 	InstanceMessageType InstanceMessageType
+	// Error is the reason for InstanceMessageDelete and InstanceMessageReconnecting, if any
+	Error error
 }
 
 type Message struct {
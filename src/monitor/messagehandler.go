@@ -2,17 +2,30 @@ package monitor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/q-controller/qapi-client/src/client"
 )
 
+var ErrNoResult = fmt.Errorf("request completed without a result")
+
 type ExecuteResult struct {
-	resultCh <-chan client.QAPIResult
+	resultCh <-chan client.Outcome
 	instance string
+	// onTimeout is called when Get gives up waiting because of a deadline
+	onTimeout func()
 }
 
-func (r *ExecuteResult) Get(ctx context.Context, timeout time.Duration) (*client.QAPIResult, bool) {
+// Get waits for the reply to the request. If QEMU answered with an error, the reply
+// is returned together with its *client.Error, which matches the client.Err* class
+// sentinels with errors.Is. Otherwise the error tells why no reply arrived:
+// client.ErrRequestCanceled, client.ErrDisconnected, client.ErrProtocol or
+// client.ErrTimeout (which also matches context.DeadlineExceeded).
+// Get only waits: the request stays pending when ctx ends, use
+// Monitor.Cancel or Monitor.ExecuteContext to abandon it.
+func (r *ExecuteResult) Get(ctx context.Context, timeout time.Duration) (*client.QAPIResult, error) {
 	newCtx := ctx
 	if timeout > 0 {
 		var cancel context.CancelFunc
@@ -21,13 +34,29 @@ func (r *ExecuteResult) Get(ctx context.Context, timeout time.Duration) (*client
 	}
 
 	select {
-	case rv, ok := <-r.resultCh:
+	case outcome, ok := <-r.resultCh:
 		if !ok {
-			return nil, false
+			return nil, ErrNoResult
+		}
+		if outcome.Err != nil {
+			return nil, outcome.Err
+		}
+		rv := outcome.Result
+		if rv.Error != nil {
+			return &rv, rv.Error
 		}
-		return &rv, true
+		if rv.Return == nil {
+			return nil, fmt.Errorf("%w: reply without return value", client.ErrProtocol)
+		}
+		return &rv, nil
 	case <-newCtx.Done():
-		return nil, false
+		if errors.Is(newCtx.Err(), context.DeadlineExceeded) {
+			if r.onTimeout != nil {
+				r.onTimeout()
+			}
+			return nil, fmt.Errorf("%w: %w", client.ErrTimeout, newCtx.Err())
+		}
+		return nil, newCtx.Err()
 	}
 }
 
@@ -35,7 +64,7 @@ func (r *ExecuteResult) Instance() string {
 	return r.instance
 }
 
-func NewExecuteResult(resultCh <-chan client.QAPIResult, instance string) *ExecuteResult {
+func NewExecuteResult(resultCh <-chan client.Outcome, instance string) *ExecuteResult {
 	return &ExecuteResult{
 		resultCh: resultCh,
 		instance: instance,
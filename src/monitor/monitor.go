@@ -3,12 +3,28 @@ package monitor
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"slices"
+	"sync"
 
 	"github.com/q-controller/qapi-client/src/client"
 	"github.com/q-controller/qapi-client/src/monitor/internal/sockets"
+	"golang.org/x/sys/unix"
 )
 
+var ErrNegotiationTimeout = fmt.Errorf("timed out waiting for QMP negotiation")
+var ErrNegotiationFailed = fmt.Errorf("QMP negotiation failed")
+var ErrUnknownInstance = fmt.Errorf("unknown instance")
+var ErrInstanceRemoved = fmt.Errorf("instance removed")
+var ErrInstanceExists = fmt.Errorf("instance already exists")
+var ErrOOBNotNegotiated = fmt.Errorf("out-of-band execution not negotiated")
+var ErrFilesUnsupported = fmt.Errorf("passing files requires a Unix domain socket connection")
+
+const cCapabilityOOB = "oob"
+
 type AddRequestFuture struct {
 	Id    string
 	Error chan error
@@ -20,68 +36,120 @@ type AddRequestResult struct {
 }
 
 type Monitor struct {
-	queue client.EventQueue
+	queue   client.EventQueue
+	options monitorOptions
 
-	messagesCh chan MonitorEvent
+	messages   *outbox[MonitorEvent]
 	addLoop    *client.Dispatcher[error]
+	removeLoop *client.Dispatcher[error]
+	listenLoop *client.Dispatcher[error]
 	executor   *client.Executor
 	stopCh     chan struct{}
+
+	mu        sync.Mutex
+	instances map[string]*instance
+	listeners map[string]*listener
+
+	closeOnce sync.Once
+	doneCh    chan struct{}
+
+	subMu       sync.Mutex
+	subscribers map[*subscriber]struct{}
+
+	droppedMu sync.Mutex
+	dropped   map[string]uint64
 }
 
-func NewMonitor() (*Monitor, error) {
-	queue, queueErr := sockets.NewAsyncQueue()
+func NewMonitor(opts ...Option) (*Monitor, error) {
+	options := newMonitorOptions(opts)
+	queue, queueErr := sockets.NewAsyncQueue(sockets.WithWriteQueueDepth(options.writeQueueDepth))
 	if queueErr != nil {
 		return nil, queueErr
 	}
 
-	messagesCh := make(chan MonitorEvent, 100)
-	addLoop := client.NewDispatcher[error](0)
-	executor := client.NewExecutor()
-	stopCh := make(chan struct{})
+	m := &Monitor{
+		queue:      queue,
+		options:    options,
+		addLoop:    client.NewDispatcher[error](0),
+		removeLoop: client.NewDispatcher[error](0),
+		listenLoop: client.NewDispatcher[error](0),
+		executor:   client.NewExecutor(),
+		stopCh:     make(chan struct{}),
+		instances:  make(map[string]*instance),
+		listeners:  make(map[string]*listener),
+		doneCh:     make(chan struct{}),
+
+		subscribers: make(map[*subscriber]struct{}),
+		dropped:     make(map[string]uint64),
+	}
+	m.messages = newOutbox(m.options.bufferSize, m.options.policy, func(ev MonitorEvent) {
+		if ev.Message != nil {
+			m.countDropped(ev.Message.Instance)
+		} else if ev.InstanceMessage != nil {
+			m.countDropped(ev.InstanceMessage.Instance)
+		}
+	})
+	executor := m.executor
 
 	go func() {
 		if events, eventsErr := queue.Wait(context.Background()); eventsErr != nil {
 			slog.Error("AsyncQueue.Wait error", "error", eventsErr)
-			stopCh <- struct{}{}
+			m.stopCh <- struct{}{}
 			return
 		} else {
 			for event := range events {
 				if event.Action != nil {
 					switch *event.Action {
 					case client.ActionAdd:
-						addLoop.Post(client.Data[error]{
-							Id:      event.Id,
-							Payload: event.Error,
-						})
-						var messageType InstanceMessageType
-						if event.Error == nil {
-							messageType = InstanceMessageAdd
+						if event.Error != nil {
+							m.failAdd(event.Id, event.Error)
+							continue
+						}
+						if inst := m.instance(event.Id); inst != nil {
+							go m.negotiate(inst)
 						} else {
-							messageType = InstanceMessageDelete
+							// removed while connecting; the event loop may be busy
+							// delivering the next event to this goroutine
+							go m.queue.Remove(event.Id)
+							m.addLoop.Post(client.Data[error]{
+								Id:      event.Id,
+								Payload: ErrInstanceRemoved,
+							})
 						}
-						messagesCh <- MonitorEvent{
-							InstanceMessage: &InstanceMessage{
-								Instance:            event.Id,
-								InstanceMessageType: messageType,
-							},
+					case client.ActionListen:
+						if event.Error != nil {
+							m.dropListener(event.Id)
 						}
+						m.listenLoop.Post(client.Data[error]{
+							Id:      event.Id,
+							Payload: event.Error,
+						})
+					case client.ActionAccept:
+						// naming is user code, which must not hold up the events
+						go m.accept(event.Id, event.Connection)
+					case client.ActionCancel, client.ActionExecute:
+						// Id refers to a request that will never get a reply
+						executor.CancelRequest(event.Id, event.Error)
+					case client.ActionRemove:
+						executor.Cancel(event.Id, fmt.Errorf("%w: %w", client.ErrDisconnected, ErrInstanceRemoved))
+						m.removeLoop.Post(client.Data[error]{
+							Id:      event.Id,
+							Payload: event.Error,
+						})
 					}
 				} else {
 					if event.Error != nil {
-						msg := Message{
-							Instance: event.Id,
-							Type:     MessageGeneric,
-							Generic:  nil,
-						}
-						messagesCh <- MonitorEvent{
-							Message: &msg,
-						}
-						executor.Cancel(event.Id)
+						executor.Cancel(event.Id, fmt.Errorf("%w: %w", client.ErrDisconnected, event.Error))
+						m.handleDisconnect(event.Id, event.Error)
 						continue
 					}
 					for _, data := range event.Data {
+						if m.handleGreeting(event.Id, data) {
+							continue
+						}
+
 						var env client.RawResponse
-						if err := json.Unmarshal([]byte(data), &env); err != nil {
+						if err := json.Unmarshal(data, &env); err != nil {
 							slog.Error("Failed to decode response", "error", err)
 							continue
 						}
@@ -90,43 +158,36 @@ func NewMonitor() (*Monitor, error) {
 							Instance: event.Id,
 						}
 						switch {
-						case env.Event != "" && env.Data != nil && env.Timestamp != nil:
+						case env.Event != "" && env.Timestamp != nil:
+							// events without arguments come without data
 							msg.Type = MessageEvent
 							var event client.QAPIEvent
-							if err := json.Unmarshal([]byte(data), &event); err != nil {
+							if err := json.Unmarshal(data, &event); err != nil {
 								slog.Error("Failed to decode QAPIEvent", "error", err)
 								break
 							}
 							msg.Event = &event
-							select {
-							case messagesCh <- MonitorEvent{
+							m.publish(msg)
+							m.emit(MonitorEvent{
 								Message: &msg,
-							}:
-							default:
-							}
-						case env.Return != nil:
+							})
+						case env.Return != nil || env.Error != nil:
 							var result client.QAPIResult
-							if err := json.Unmarshal([]byte(data), &result); err != nil {
+							if err := json.Unmarshal(data, &result); err != nil {
 								slog.Error("Failed to decode QAPIResult", "error", err)
 								break
 							}
 							executor.Complete(result.Id, result)
-							msg.Generic = []byte(data)
-							select {
-							case messagesCh <- MonitorEvent{
+							msg.Generic = data
+							m.emit(MonitorEvent{
 								Message: &msg,
-							}:
-							default:
-							}
+							})
 						default:
 							msg.Type = MessageGeneric
-							msg.Generic = []byte(data)
-							select {
-							case messagesCh <- MonitorEvent{
+							msg.Generic = data
+							m.emit(MonitorEvent{
 								Message: &msg,
-							}:
-							default:
-							}
+							})
 						}
 					}
 				}
@@ -135,37 +196,367 @@ func NewMonitor() (*Monitor, error) {
 	}()
 
 	go func() {
-		addLoopCancel, _ := addLoop.Run(context.Background())
-		requestCancel := executor.Run(context.Background())
+		addLoopCancel, _ := m.addLoop.Run(context.Background())
+		removeLoopCancel, _ := m.removeLoop.Run(context.Background())
+		listenLoopCancel, _ := m.listenLoop.Run(context.Background())
+		requestCancel := m.executor.Run(context.Background())
 		defer requestCancel()
+		defer listenLoopCancel()
+		defer removeLoopCancel()
 		defer addLoopCancel()
-		<-stopCh
+		<-m.stopCh
 	}()
 
-	return &Monitor{
-		queue:      queue,
-		messagesCh: messagesCh,
-		stopCh:     stopCh,
-		addLoop:    addLoop,
-		executor:   executor,
-	}, nil
+	return m, nil
 }
 
-func (m *Monitor) Add(name, socketPath string) <-chan error {
-	ch := m.addLoop.Enqueue(name)
-	if err := m.queue.Add(name, client.CommunicationConfig{
+// Add connects to an instance exposing QMP on a Unix domain socket.
+// The returned channel resolves once the greeting has been received and the
+// requested capabilities negotiated, i.e. the instance is in command mode, or
+// with ErrInstanceExists if name is taken.
+func (m *Monitor) Add(name, socketPath string, opts ...AddOption) <-chan error {
+	return m.add(name, client.CommunicationConfig{
 		Type: client.UnixDomain,
 		UnixDomain: &client.UnixDomainConfig{
 			SocketPath: socketPath,
 		},
-	}); err != nil {
-		m.addLoop.Post(client.Data[error]{
+	}, opts)
+}
+
+// AddTCP connects to an instance exposing QMP over TCP (-qmp tcp:host:port,server=on).
+func (m *Monitor) AddTCP(name string, config client.TCPConfig, opts ...AddOption) <-chan error {
+	return m.add(name, client.CommunicationConfig{
+		Type: client.TCP,
+		TCP:  &config,
+	}, opts)
+}
+
+func (m *Monitor) add(name string, config client.CommunicationConfig, opts []AddOption) <-chan error {
+	return m.addInstance(newInstance(name, config, newAddOptions(opts)))
+}
+
+// addInstance connects inst unless its name is taken, by an instance or a listener.
+func (m *Monitor) addInstance(inst *instance) <-chan error {
+	m.mu.Lock()
+	_, exists := m.instances[inst.name]
+	_, listening := m.listeners[inst.name]
+	if !exists && !listening {
+		m.instances[inst.name] = inst
+	}
+	m.mu.Unlock()
+
+	if exists || listening {
+		resultCh := make(chan error, 1)
+		resultCh <- fmt.Errorf("%w: %q", ErrInstanceExists, inst.name)
+		close(resultCh)
+		return resultCh
+	}
+
+	return m.connect(inst)
+}
+
+// connect opens the instance's connection; the returned channel resolves once it is negotiated.
+func (m *Monitor) connect(inst *instance) <-chan error {
+	ch := m.addLoop.Enqueue(inst.name)
+	if err := m.queue.Add(inst.name, inst.config); err != nil {
+		m.failAdd(inst.name, err)
+	}
+	if process := inst.config.Process; process != nil && process.Cmd != nil {
+		// reaps the process even if attaching it failed
+		m.trackProcess(inst, process.Cmd)
+	}
+
+	return ch
+}
+
+// Remove disconnects the instance: its connection is closed, pending requests fail
+// with ErrDisconnected and InstanceMessageDelete is emitted once it is gone.
+// A pending Add fails with ErrInstanceRemoved and a pending reconnect is abandoned.
+// Removing a listener stops accepting connections.
+func (m *Monitor) Remove(name string) <-chan error {
+	resultCh := make(chan error, 1)
+	isListener := m.dropListener(name)
+	inst := m.instance(name)
+	if !isListener && inst == nil {
+		resultCh <- fmt.Errorf("%w: %q", ErrUnknownInstance, name)
+		close(resultCh)
+		return resultCh
+	}
+	m.dropInstance(name)
+	if inst != nil {
+		// an Add still waiting for the greeting fails right away
+		select {
+		case inst.disconnectedCh <- ErrInstanceRemoved:
+		default:
+		}
+		m.killProcess(inst)
+	}
+
+	ch := m.removeLoop.Enqueue(name)
+	if err := m.queue.Remove(name); err != nil {
+		m.removeLoop.Post(client.Data[error]{
 			Id:      name,
 			Payload: err,
 		})
 	}
 
-	return ch
+	go func() {
+		defer close(resultCh)
+		err, ok := <-ch
+		if !ok {
+			// another Remove of the same instance is in flight and reports it
+			return
+		}
+		if err == nil && !isListener {
+			m.emit(MonitorEvent{
+				InstanceMessage: &InstanceMessage{
+					Instance:            name,
+					InstanceMessageType: InstanceMessageDelete,
+				},
+			})
+		}
+		resultCh <- err
+	}()
+
+	return resultCh
+}
+
+// Greeting returns the greeting the instance sent when the connection was established.
+func (m *Monitor) Greeting(name string) (*client.Greeting, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inst, exists := m.instances[name]; exists && inst.greeting != nil {
+		return inst.greeting, true
+	}
+	return nil, false
+}
+
+func (m *Monitor) hasCapability(name, capability string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inst, exists := m.instances[name]
+	return exists && slices.Contains(inst.capabilities, capability)
+}
+
+func (m *Monitor) instance(name string) *instance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances[name]
+}
+
+func (m *Monitor) dropInstance(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, name)
+}
+
+// handleGreeting consumes the first {"QMP": ...} message of an instance.
+func (m *Monitor) handleGreeting(name string, data []byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inst, exists := m.instances[name]
+	if !exists || inst.greeting != nil || inst.options.protocol != ProtocolQMP {
+		return false
+	}
+
+	var greeting client.Greeting
+	if err := json.Unmarshal(data, &greeting); err != nil || greeting.QMP == nil {
+		return false
+	}
+	inst.greeting = &greeting
+	inst.greetingCh <- struct{}{}
+	return true
+}
+
+// failAdd resolves a connection attempt with err. Unless the instance is reconnecting,
+// in which case the reconnect loop decides what happens next, the instance is removed.
+// It runs on the event goroutine too, so closing a connection that was registered
+// is up to the caller.
+func (m *Monitor) failAdd(name string, err error) {
+	m.mu.Lock()
+	inst, exists := m.instances[name]
+	reconnecting := exists && inst.reconnecting
+	if exists && !reconnecting {
+		delete(m.instances, name)
+	}
+	m.mu.Unlock()
+	if exists && !reconnecting {
+		m.killProcess(inst)
+	}
+
+	m.addLoop.Post(client.Data[error]{
+		Id:      name,
+		Payload: err,
+	})
+	if !exists || reconnecting {
+		return
+	}
+	m.emit(MonitorEvent{
+		InstanceMessage: &InstanceMessage{
+			Instance:            name,
+			InstanceMessageType: InstanceMessageDelete,
+			Error:               err,
+		},
+	})
+}
+
+// negotiate waits for the greeting and switches the instance into command mode.
+func (m *Monitor) negotiate(inst *instance) {
+	if err := m.enterCommandMode(inst); err != nil {
+		slog.Error("QMP negotiation failed", "instance", inst.name, "error", err)
+		if m.instance(inst.name) != inst {
+			// removed meanwhile, the name may already belong to another instance
+			m.addLoop.Post(client.Data[error]{
+				Id:      inst.name,
+				Payload: err,
+			})
+			return
+		}
+		// a connection that could not be negotiated is of no use
+		m.queue.Remove(inst.name)
+		m.failAdd(inst.name, err)
+		return
+	}
+
+	m.mu.Lock()
+	current := m.instances[inst.name] == inst
+	// cleared along with setting ready, so that the next disconnect starts a
+	// new reconnect rather than finding this one still running
+	reconnecting := inst.reconnecting
+	inst.ready = true
+	inst.reconnecting = false
+	m.mu.Unlock()
+
+	if !current {
+		m.addLoop.Post(client.Data[error]{
+			Id:      inst.name,
+			Payload: ErrInstanceRemoved,
+		})
+		return
+	}
+	m.addLoop.Post(client.Data[error]{
+		Id:      inst.name,
+		Payload: nil,
+	})
+	messageType := InstanceMessageAdd
+	if reconnecting {
+		messageType = InstanceMessageReconnected
+	}
+	m.emit(MonitorEvent{
+		InstanceMessage: &InstanceMessage{
+			Instance:            inst.name,
+			InstanceMessageType: messageType,
+		},
+	})
+}
+
+// handleDisconnect reacts to a dropped connection: a negotiated instance with a
+// ReconnectPolicy starts reconnecting, any other one is removed. A connection that
+// drops while negotiating fails the pending add, or reconnect attempt, right away.
+func (m *Monitor) handleDisconnect(name string, err error) {
+	m.mu.Lock()
+	inst, exists := m.instances[name]
+	if exists && !inst.ready {
+		select {
+		case inst.disconnectedCh <- err:
+		default:
+		}
+		m.mu.Unlock()
+		return
+	}
+	if exists && inst.config.Type == client.Process {
+		// without its stdio the process is of no use; the instance is reported
+		// once the process exited, with its exit status
+		delete(m.instances, name)
+		inst.hungUp = true
+		m.mu.Unlock()
+		m.killProcess(inst)
+		return
+	}
+	reconnect := exists && inst.ready && inst.options.reconnect != nil
+	if reconnect {
+		inst.reconnecting = true
+		inst.ready = false
+	} else {
+		delete(m.instances, name)
+	}
+	m.mu.Unlock()
+
+	if reconnect {
+		m.emit(MonitorEvent{
+			InstanceMessage: &InstanceMessage{
+				Instance:            name,
+				InstanceMessageType: InstanceMessageReconnecting,
+				Error:               err,
+			},
+		})
+		go m.reconnect(inst)
+		return
+	}
+
+	m.emit(MonitorEvent{
+		Message: &Message{
+			Instance: name,
+			Type:     MessageGeneric,
+			Generic:  nil,
+		},
+	})
+}
+
+func (m *Monitor) enterCommandMode(inst *instance) error {
+	ctx, cancel := context.WithTimeout(context.Background(), inst.options.negotiationTimeout)
+	defer cancel()
+
+	if inst.options.protocol == ProtocolQGA {
+		return m.syncAgent(ctx, inst)
+	}
+
+	select {
+	case <-inst.greetingCh:
+	case err := <-inst.disconnectedCh:
+		return fmt.Errorf("%w: %w", client.ErrDisconnected, err)
+	case <-ctx.Done():
+		return ErrNegotiationTimeout
+	}
+
+	capabilities := inst.options.capabilities
+	if !inst.options.capabilitiesSet && slices.Contains(inst.greeting.QMP.Capabilities, cCapabilityOOB) {
+		capabilities = []string{cCapabilityOOB}
+	}
+
+	arguments, argumentsErr := json.Marshal(struct {
+		Enable []string `json:"enable,omitempty"`
+	}{
+		Enable: capabilities,
+	})
+	if argumentsErr != nil {
+		return argumentsErr
+	}
+
+	result, executeErr := m.Execute(inst.name, client.Request{
+		Id:        client.GenerateId(),
+		Execute:   "qmp_capabilities",
+		Arguments: arguments,
+	})
+	if executeErr != nil {
+		return executeErr
+	}
+
+	if _, err := result.Get(ctx, 0); err != nil {
+		if ctx.Err() != nil {
+			return ErrNegotiationTimeout
+		}
+		return fmt.Errorf("%w: %w", ErrNegotiationFailed, err)
+	}
+
+	m.mu.Lock()
+	inst.capabilities = capabilities
+	m.mu.Unlock()
+
+	return nil
 }
 
 func (m *Monitor) Cancel(requestId string) error {
@@ -177,19 +568,164 @@ func (m *Monitor) Cancel(requestId string) error {
 }
 
 func (m *Monitor) Close() error {
-	close(m.messagesCh)
+	closed := false
+	m.closeOnce.Do(func() {
+		close(m.doneCh)
+		closed = true
+	})
+	if !closed {
+		return nil
+	}
+
+	for _, process := range m.processes() {
+		_ = process.Kill()
+	}
+	m.messages.close()
 	return m.queue.Close()
 }
 
+// Execute sends the request to the instance. Out-of-band requests (ExecOOB) are
+// rejected with ErrOOBNotNegotiated unless the oob capability was negotiated.
 func (m *Monitor) Execute(name string, request client.Request) (*ExecuteResult, error) {
+	return m.execute(context.Background(), name, request, nil)
+}
+
+// execute hands the request, and fds if any, over to the queue, waiting for room in
+// it until ctx ends. fds are closed whatever the outcome.
+func (m *Monitor) execute(ctx context.Context, name string, request client.Request, fds []int) (*ExecuteResult, error) {
+	if request.ExecOOB != "" && !m.hasCapability(name, cCapabilityOOB) {
+		closeAll(fds)
+		return nil, fmt.Errorf("%w: %s on %q", ErrOOBNotNegotiated, request.ExecOOB, name)
+	}
+
 	ch := m.executor.Enqueue(name, request.Id)
+	var err error
+	if len(fds) > 0 {
+		err = m.queue.ExecuteWithFds(ctx, name, request, fds)
+	} else {
+		err = m.queue.ExecuteContext(ctx, name, request)
+	}
+	if err != nil {
+		m.executor.CancelRequest(request.Id, err)
+		return nil, err
+	}
+
+	return m.newExecuteResult(name, ch), nil
+}
+
+// ExecuteWithFiles sends the request together with files, passed to QEMU as
+// SCM_RIGHTS ancillary data, e.g. for getfd or add-fd. The files are duplicated,
+// so the caller may close them once ExecuteWithFiles returns. Only instances
+// connected over a Unix domain socket can receive files.
+func (m *Monitor) ExecuteWithFiles(name string, request client.Request, files []*os.File) (*ExecuteResult, error) {
+	return m.executeWithFiles(context.Background(), name, request, files)
+}
+
+func (m *Monitor) executeWithFiles(ctx context.Context, name string, request client.Request, files []*os.File) (*ExecuteResult, error) {
+	inst := m.instance(name)
+	if inst == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownInstance, name)
+	}
+	if inst.config.Type != client.UnixDomain {
+		return nil, fmt.Errorf("%w: %q", ErrFilesUnsupported, name)
+	}
 
-	return &ExecuteResult{
+	fds := make([]int, 0, len(files))
+	for _, file := range files {
+		// not leaking into processes forked before the fds are sent
+		fd, dupErr := unix.FcntlInt(file.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+		if dupErr != nil {
+			closeAll(fds)
+			return nil, fmt.Errorf("could not duplicate %s: %w", file.Name(), dupErr)
+		}
+		fds = append(fds, fd)
+	}
+
+	return m.execute(ctx, name, request, fds)
+}
+
+// ExecuteWithFilesContext is ExecuteContext passing files along like
+// ExecuteWithFiles.
+func (m *Monitor) ExecuteWithFilesContext(ctx context.Context, name string, request client.Request, files []*os.File) (*client.QAPIResult, error) {
+	if request.Id == "" {
+		request.Id = client.GenerateId()
+	}
+
+	result, executeErr := m.executeWithFiles(ctx, name, request, files)
+	if executeErr != nil {
+		return nil, executeErr
+	}
+	return m.wait(ctx, request.Id, result)
+}
+
+func closeAll(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
+
+func (m *Monitor) newExecuteResult(name string, ch <-chan client.Outcome) *ExecuteResult {
+	result := &ExecuteResult{
 		resultCh: ch,
 		instance: name,
-	}, m.queue.Execute(name, request)
+	}
+	if inst := m.instance(name); inst != nil && inst.options.protocol == ProtocolQGA {
+		result.onTimeout = func() {
+			go m.resync(inst)
+		}
+	}
+	return result
+}
+
+// ExecuteContext executes the request and waits for its reply. If ctx ends first,
+// the request is canceled through the queue's management path, so neither the
+// Executor nor the Dispatcher keep its subscription, and a reply QEMU sends
+// later is dropped. The returned error then matches ctx.Err().
+// A request without an Id gets a generated one. Handing the request over to the
+// queue also gives up once ctx ends.
+func (m *Monitor) ExecuteContext(ctx context.Context, name string, request client.Request) (*client.QAPIResult, error) {
+	if request.Id == "" {
+		request.Id = client.GenerateId()
+	}
+
+	result, executeErr := m.execute(ctx, name, request, nil)
+	if executeErr != nil {
+		return nil, executeErr
+	}
+	return m.wait(ctx, request.Id, result)
+}
+
+// wait waits for the reply to the request, canceling it if ctx ends first.
+func (m *Monitor) wait(ctx context.Context, requestId string, result *ExecuteResult) (*client.QAPIResult, error) {
+	res, resErr := result.Get(ctx, 0)
+	if resErr != nil && ctx.Err() != nil && errors.Is(resErr, ctx.Err()) {
+		if cancelErr := m.Cancel(requestId); cancelErr != nil {
+			m.executor.CancelRequest(requestId, ctx.Err())
+		}
+	}
+
+	return res, resErr
 }
 
 func (m *Monitor) Messages() <-chan MonitorEvent {
-	return m.messagesCh
+	return m.messages.ch
+}
+
+// Dropped returns how many messages of the instance were discarded because a
+// consumer lagged behind, see DeliveryPolicy.
+func (m *Monitor) Dropped(instance string) uint64 {
+	m.droppedMu.Lock()
+	defer m.droppedMu.Unlock()
+	return m.dropped[instance]
+}
+
+func (m *Monitor) countDropped(instance string) {
+	m.droppedMu.Lock()
+	defer m.droppedMu.Unlock()
+	m.dropped[instance]++
+}
+
+// emit delivers ev to the Messages() consumer according to the delivery policy.
+func (m *Monitor) emit(ev MonitorEvent) {
+	m.messages.deliver(ev)
 }
@@ -0,0 +1,812 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qapi-client/src/client"
+	"golang.org/x/sys/unix"
+)
+
+const testGreeting = `{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 9}, "package": ""}, "capabilities": ["oob"]}}`
+
+func listenTCP(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+// closeConnection makes serveQMP hang up instead of replying.
+const closeConnection = "close"
+
+// serveQMP plays the QEMU side of a connection: it sends the greeting and answers
+// every request with the reply produced by handler (nothing if it is empty).
+func serveQMP(conn net.Conn, handler func(req client.Request) string) {
+	defer conn.Close()
+	if _, err := conn.Write([]byte(testGreeting + "\r\n")); err != nil {
+		return
+	}
+	decoder := json.NewDecoder(conn)
+	for {
+		var req client.Request
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+		reply := handler(req)
+		if reply == closeConnection {
+			return
+		}
+		if reply != "" {
+			if _, err := conn.Write([]byte(reply + "\r\n")); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func okReply(req client.Request) string {
+	return fmt.Sprintf(`{"return": {}, "id": %q}`, req.Id)
+}
+
+func acceptOne(listener net.Listener, handler func(req client.Request) string) {
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		serveQMP(conn, handler)
+	}()
+}
+
+func newTestMonitor(t *testing.T) *Monitor {
+	t.Helper()
+	mon, monErr := NewMonitor()
+	if monErr != nil {
+		t.Fatalf("NewMonitor: %v", monErr)
+	}
+	t.Cleanup(func() { mon.Close() })
+	return mon
+}
+
+func waitAdd(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Add")
+	}
+	return nil
+}
+
+func waitMessage(t *testing.T, ch <-chan MonitorEvent, match func(MonitorEvent) bool) MonitorEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatal("messages channel closed")
+			}
+			if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestMonitorAddTCP(t *testing.T) {
+	listener, port := listenTCP(t)
+	acceptOne(listener, okReply)
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port, DialTimeout: time.Second})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == "tcp-instance" &&
+			ev.InstanceMessage.InstanceMessageType == InstanceMessageAdd
+	})
+
+	greeting, ok := mon.Greeting("tcp-instance")
+	if !ok {
+		t.Fatal("greeting not recorded")
+	}
+	if v := greeting.QMP.Version.Qemu; v.Major != 9 || v.Minor != 2 || v.Micro != 0 {
+		t.Errorf("version = %+v, want 9.2.0", v)
+	}
+}
+
+func TestMonitorAddTCPRefused(t *testing.T) {
+	listener, port := listenTCP(t)
+	listener.Close()
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port, DialTimeout: time.Second})); err == nil {
+		t.Fatal("AddTCP succeeded against a closed port")
+	}
+}
+
+func TestMonitorAddDuplicate(t *testing.T) {
+	listener, port := listenTCP(t)
+	acceptOne(listener, okReply)
+
+	mon := newTestMonitor(t)
+	config := client.TCPConfig{Host: "127.0.0.1", Port: port}
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", config)); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", config)); !errors.Is(err, ErrInstanceExists) {
+		t.Errorf("second AddTCP error = %v, want %v", err, ErrInstanceExists)
+	}
+	if err := waitAdd(t, mon.AddProcess("tcp-instance", fakeQMPCommand())); !errors.Is(err, ErrInstanceExists) {
+		t.Errorf("AddProcess error = %v, want %v", err, ErrInstanceExists)
+	}
+	if err := waitAdd(t, mon.Listen("tcp-instance", filepath.Join(t.TempDir(), "qmp.sock"), nil)); !errors.Is(err, ErrListenerExists) {
+		t.Errorf("Listen error = %v, want %v", err, ErrListenerExists)
+	}
+
+	if _, err := mon.ExecuteContext(t.Context(), "tcp-instance", client.Request{Execute: "query-status"}); err != nil {
+		t.Errorf("ExecuteContext on the first instance: %v", err)
+	}
+}
+
+func TestMonitorNegotiatesCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []AddOption
+		want []string
+	}{
+		{name: "offered oob", want: []string{"oob"}},
+		{name: "explicit", opts: []AddOption{WithCapabilities("oob")}, want: []string{"oob"}},
+		{name: "opt out", opts: []AddOption{WithCapabilities()}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, port := listenTCP(t)
+			enabled := make(chan []string, 1)
+			acceptOne(listener, func(req client.Request) string {
+				if req.Execute == "qmp_capabilities" {
+					var args struct {
+						Enable []string `json:"enable"`
+					}
+					_ = json.Unmarshal(req.Arguments, &args)
+					enabled <- args.Enable
+				}
+				return okReply(req)
+			})
+
+			mon := newTestMonitor(t)
+			if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port}, tt.opts...)); err != nil {
+				t.Fatalf("AddTCP: %v", err)
+			}
+
+			select {
+			case caps := <-enabled:
+				if !reflect.DeepEqual(caps, tt.want) {
+					t.Errorf("enabled capabilities = %v, want %v", caps, tt.want)
+				}
+			default:
+				t.Fatal("qmp_capabilities was not sent before Add resolved")
+			}
+		})
+	}
+}
+
+func TestMonitorExecuteOOB(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []AddOption
+		wantErr error
+	}{
+		{name: "negotiated"},
+		{name: "not negotiated", opts: []AddOption{WithCapabilities()}, wantErr: ErrOOBNotNegotiated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, port := listenTCP(t)
+			acceptOne(listener, okReply)
+
+			mon := newTestMonitor(t)
+			if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port}, tt.opts...)); err != nil {
+				t.Fatalf("AddTCP: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			_, err := mon.ExecuteContext(ctx, "tcp-instance", client.Request{ExecOOB: "x-oob-test"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExecuteContext error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMonitorNegotiationTimeout(t *testing.T) {
+	listener, port := listenTCP(t)
+	hungUp := make(chan struct{})
+	go func() {
+		// Accept, but never send the greeting
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Read(make([]byte, 1))
+		close(hungUp)
+	}()
+
+	mon := newTestMonitor(t)
+	err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port}, WithNegotiationTimeout(100*time.Millisecond)))
+	if !errors.Is(err, ErrNegotiationTimeout) {
+		t.Fatalf("AddTCP error = %v, want %v", err, ErrNegotiationTimeout)
+	}
+
+	select {
+	case <-hungUp:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection left open after the negotiation failed")
+	}
+}
+
+func TestMonitorDisconnectBeforeGreeting(t *testing.T) {
+	listener, port := listenTCP(t)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}()
+
+	mon := newTestMonitor(t)
+	// well within the default negotiation timeout
+	err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port}))
+	if !errors.Is(err, client.ErrDisconnected) {
+		t.Fatalf("AddTCP error = %v, want %v", err, client.ErrDisconnected)
+	}
+	if mon.instance("tcp-instance") != nil {
+		t.Error("instance kept after its connection dropped")
+	}
+}
+
+func TestMonitorRemoveWhileNegotiating(t *testing.T) {
+	listener, port := listenTCP(t)
+	go func() {
+		// Send an event instead of the greeting, so that the instance is known
+		// to be negotiating once the event is delivered
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "{\"event\": \"STOP\"}\r\n")
+		_, _ = conn.Read(make([]byte, 1))
+	}()
+
+	mon := newTestMonitor(t)
+	addCh := mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})
+	waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.Message != nil && ev.Message.Instance == "tcp-instance"
+	})
+	if err := waitAdd(t, mon.Remove("tcp-instance")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	// well within the default negotiation timeout
+	if err := waitAdd(t, addCh); !errors.Is(err, ErrInstanceRemoved) {
+		t.Fatalf("AddTCP error = %v, want %v", err, ErrInstanceRemoved)
+	}
+}
+
+func TestMonitorRemove(t *testing.T) {
+	listener, port := listenTCP(t)
+	hungUp := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		serveQMP(conn, func(req client.Request) string {
+			if req.Execute == "hang" {
+				return ""
+			}
+			return okReply(req)
+		})
+		close(hungUp)
+	}()
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	pending, executeErr := mon.Execute("tcp-instance", client.Request{Id: client.GenerateId(), Execute: "hang"})
+	if executeErr != nil {
+		t.Fatalf("Execute: %v", executeErr)
+	}
+	if err := waitAdd(t, mon.Remove("tcp-instance")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if _, err := pending.Get(t.Context(), 5*time.Second); !errors.Is(err, client.ErrDisconnected) || !errors.Is(err, ErrInstanceRemoved) {
+		t.Errorf("pending request error = %v, want %v", err, ErrInstanceRemoved)
+	}
+	waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == "tcp-instance" &&
+			ev.InstanceMessage.InstanceMessageType == InstanceMessageDelete
+	})
+	select {
+	case <-hungUp:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection left open after Remove")
+	}
+
+	if err := waitAdd(t, mon.Remove("tcp-instance")); !errors.Is(err, ErrUnknownInstance) {
+		t.Errorf("second Remove error = %v, want %v", err, ErrUnknownInstance)
+	}
+}
+
+func TestMonitorExecuteErrorReply(t *testing.T) {
+	listener, port := listenTCP(t)
+	acceptOne(listener, func(req client.Request) string {
+		if req.Execute == "bogus" {
+			return fmt.Sprintf(`{"id": %q, "error": {"class": "CommandNotFound", "desc": "The command bogus has not been found"}}`, req.Id)
+		}
+		return okReply(req)
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	result, executeErr := mon.Execute("tcp-instance", client.Request{Id: client.GenerateId(), Execute: "bogus"})
+	if executeErr != nil {
+		t.Fatalf("Execute: %v", executeErr)
+	}
+
+	res, err := result.Get(t.Context(), 5*time.Second)
+	var qmpErr *client.Error
+	if !errors.As(err, &qmpErr) {
+		t.Fatalf("Get error = %v, want *client.Error", err)
+	}
+	if !errors.Is(err, client.ErrCommandNotFound) || errors.Is(err, client.ErrGenericError) {
+		t.Errorf("class = %q, want CommandNotFound", qmpErr.Class)
+	}
+	if res == nil || res.Error == nil {
+		t.Errorf("reply not returned alongside the error: %+v", res)
+	}
+}
+
+func TestMonitorExecuteFailures(t *testing.T) {
+	listener, port := listenTCP(t)
+	acceptOne(listener, func(req client.Request) string {
+		switch req.Execute {
+		case "hang":
+			return ""
+		case "quit":
+			return closeConnection
+		}
+		return okReply(req)
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	execute := func(command string) (*ExecuteResult, string) {
+		t.Helper()
+		id := client.GenerateId()
+		result, err := mon.Execute("tcp-instance", client.Request{Id: id, Execute: command})
+		if err != nil {
+			t.Fatalf("Execute(%s): %v", command, err)
+		}
+		return result, id
+	}
+
+	timedOut, _ := execute("hang")
+	if _, err := timedOut.Get(t.Context(), 50*time.Millisecond); !errors.Is(err, client.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout error = %v", err)
+	}
+
+	canceled, canceledId := execute("hang")
+	if err := mon.Cancel(canceledId); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := canceled.Get(t.Context(), 5*time.Second); !errors.Is(err, client.ErrRequestCanceled) {
+		t.Errorf("cancel error = %v, want %v", err, client.ErrRequestCanceled)
+	}
+
+	disconnected, _ := execute("hang")
+	_, _ = execute("quit")
+	if _, err := disconnected.Get(t.Context(), 5*time.Second); !errors.Is(err, client.ErrDisconnected) {
+		t.Errorf("disconnect error = %v, want %v", err, client.ErrDisconnected)
+	}
+}
+
+func TestMonitorExecuteWithFilesContext(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "qmp.sock")
+	listener, listenErr := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if listenErr != nil {
+		t.Fatalf("listen: %v", listenErr)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte(testGreeting + "\r\n")); err != nil {
+			return
+		}
+		buf := make([]byte, 4096)
+		oob := make([]byte, unix.CmsgSpace(4))
+		for {
+			// the client waits for every reply, so each read is one request
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			if err != nil {
+				return
+			}
+			var req client.Request
+			if err := json.Unmarshal(buf[:n], &req); err != nil {
+				return
+			}
+			if oobn > 0 {
+				messages, _ := unix.ParseSocketControlMessage(oob[:oobn])
+				for _, message := range messages {
+					fds, _ := unix.ParseUnixRights(&message)
+					for _, fd := range fds {
+						_, _ = unix.Write(fd, []byte(req.Execute))
+						_ = unix.Close(fd)
+					}
+				}
+			}
+			if _, err := conn.Write([]byte(okReply(req) + "\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.Add("unix-instance", socketPath, WithCapabilities())); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	r, w, pipeErr := os.Pipe()
+	if pipeErr != nil {
+		t.Fatalf("Pipe: %v", pipeErr)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if _, err := mon.ExecuteWithFilesContext(ctx, "unix-instance", client.Request{ExecOOB: "getfd"}, []*os.File{w}); !errors.Is(err, ErrOOBNotNegotiated) {
+		t.Errorf("out-of-band ExecuteWithFilesContext error = %v, want %v", err, ErrOOBNotNegotiated)
+	}
+	if _, err := mon.ExecuteWithFilesContext(ctx, "unix-instance", client.Request{Execute: "getfd"}, []*os.File{w}); err != nil {
+		t.Fatalf("ExecuteWithFilesContext: %v", err)
+	}
+	w.Close()
+	if got, err := io.ReadAll(r); err != nil || string(got) != "getfd" {
+		t.Errorf("passed file got %q, %v, want %q", got, err, "getfd")
+	}
+}
+
+func TestMonitorExecuteWithFilesRequiresUnixSocket(t *testing.T) {
+	listener, port := listenTCP(t)
+	acceptOne(listener, okReply)
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	request := client.Request{Id: client.GenerateId(), Execute: "getfd"}
+	if _, err := mon.ExecuteWithFiles("tcp-instance", request, []*os.File{os.Stdin}); !errors.Is(err, ErrFilesUnsupported) {
+		t.Errorf("ExecuteWithFiles error = %v, want %v", err, ErrFilesUnsupported)
+	}
+	if _, err := mon.ExecuteWithFiles("missing", request, nil); !errors.Is(err, ErrUnknownInstance) {
+		t.Errorf("ExecuteWithFiles error = %v, want %v", err, ErrUnknownInstance)
+	}
+}
+
+func TestMonitorExecuteContext(t *testing.T) {
+	listener, port := listenTCP(t)
+	hung := make(chan client.Request, 1)
+	acceptOne(listener, func(req client.Request) string {
+		if req.Execute == "hang" {
+			hung <- req
+			return ""
+		}
+		return okReply(req)
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	if res, err := mon.ExecuteContext(t.Context(), "tcp-instance", client.Request{Execute: "query-status"}); err != nil || res.Id == "" {
+		t.Fatalf("ExecuteContext = %+v, %v", res, err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-hung
+		cancel()
+	}()
+	if _, err := mon.ExecuteContext(ctx, "tcp-instance", client.Request{Execute: "hang"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled error = %v, want %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := mon.ExecuteContext(ctx, "tcp-instance", client.Request{Execute: "hang"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("deadline error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMonitorExecuteContextWaitsForQueue(t *testing.T) {
+	listener, port := listenTCP(t)
+	stalled := make(chan struct{})
+	release := make(chan struct{})
+	acceptOne(listener, func(req client.Request) string {
+		if req.Execute == "stall" {
+			// stops reading, so the writes pile up
+			close(stalled)
+			<-release
+		}
+		return okReply(req)
+	})
+
+	mon, monErr := NewMonitor(WithWriteQueueDepth(1))
+	if monErr != nil {
+		t.Fatalf("NewMonitor: %v", monErr)
+	}
+	t.Cleanup(func() { mon.Close() })
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	results := []*ExecuteResult{}
+	execute := func(request client.Request) {
+		request.Id = client.GenerateId()
+		res, err := mon.Execute("tcp-instance", request)
+		if err != nil {
+			t.Fatalf("Execute(%s): %v", request.Execute, err)
+		}
+		results = append(results, res)
+	}
+	execute(client.Request{Execute: "stall"})
+	<-stalled
+	// more than the socket buffers hold, so the writer waits for the fd to drain
+	fill, fillErr := json.Marshal(map[string]string{"data": strings.Repeat("x", 16<<20)})
+	if fillErr != nil {
+		t.Fatalf("Marshal: %v", fillErr)
+	}
+	execute(client.Request{Execute: "fill", Arguments: fill})
+	execute(client.Request{Execute: "queued"})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := mon.ExecuteContext(ctx, "tcp-instance", client.Request{Execute: "query-status"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecuteContext on a full queue = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	for _, res := range results {
+		if _, err := res.Get(t.Context(), 5*time.Second); err != nil {
+			t.Errorf("queued request: %v", err)
+		}
+	}
+	if _, err := mon.ExecuteContext(t.Context(), "tcp-instance", client.Request{Execute: "query-status"}); err != nil {
+		t.Errorf("ExecuteContext once the queue drained: %v", err)
+	}
+}
+
+func eventReply(req client.Request, events ...string) string {
+	reply := okReply(req)
+	for _, event := range events {
+		reply += "\r\n" + event
+	}
+	return reply
+}
+
+func receiveEvents(t *testing.T, ch <-chan Message, count int) []Message {
+	t.Helper()
+	var messages []Message
+	timeout := time.After(5 * time.Second)
+	for len(messages) < count {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				t.Fatal("subscription closed")
+			}
+			messages = append(messages, msg)
+		case <-timeout:
+			t.Fatalf("received %d events, want %d", len(messages), count)
+		}
+	}
+	return messages
+}
+
+func TestMonitorSubscribe(t *testing.T) {
+	const (
+		shutdown = `{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}, "timestamp": {"seconds": 1700000000, "microseconds": 1}}`
+		reset    = `{"event": "RESET", "data": {"guest": false, "reason": "host-qmp-system-reset"}, "timestamp": {"seconds": 1700000000, "microseconds": 2}}`
+		stop     = `{"event": "STOP", "data": {}, "timestamp": {"seconds": 1700000000, "microseconds": 3}}`
+	)
+	emit := func(req client.Request) string {
+		if req.Execute == "emit" {
+			return eventReply(req, shutdown, reset, stop)
+		}
+		return okReply(req)
+	}
+
+	first, firstPort := listenTCP(t)
+	acceptOne(first, emit)
+	second, secondPort := listenTCP(t)
+	acceptOne(second, emit)
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("first", client.TCPConfig{Host: "127.0.0.1", Port: firstPort})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+	if err := waitAdd(t, mon.AddTCP("second", client.TCPConfig{Host: "127.0.0.1", Port: secondPort})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	all := mon.Subscribe(ctx, EventFilter{})
+	byName := mon.Subscribe(ctx, EventFilter{Instances: []string{"second"}, Events: []string{"SHUTDOWN", "RESET"}})
+	byData := mon.Subscribe(ctx, EventFilter{Match: func(instance string, event *client.QAPIEvent) bool {
+		var data struct {
+			Guest bool `json:"guest"`
+		}
+		return json.Unmarshal(event.Data, &data) == nil && data.Guest
+	}})
+
+	for _, name := range []string{"first", "second"} {
+		if _, err := mon.ExecuteContext(t.Context(), name, client.Request{Execute: "emit"}); err != nil {
+			t.Fatalf("ExecuteContext: %v", err)
+		}
+	}
+
+	if got := receiveEvents(t, all, 6); len(got) != 6 {
+		t.Errorf("unfiltered subscriber got %d events", len(got))
+	}
+	for _, msg := range receiveEvents(t, byName, 2) {
+		if msg.Instance != "second" || (msg.Event.Event != "SHUTDOWN" && msg.Event.Event != "RESET") {
+			t.Errorf("unexpected event %s from %s", msg.Event.Event, msg.Instance)
+		}
+	}
+	for _, msg := range receiveEvents(t, byData, 2) {
+		if msg.Event.Event != "SHUTDOWN" {
+			t.Errorf("unexpected event %s from %s", msg.Event.Event, msg.Instance)
+		}
+	}
+
+	cancel()
+	for _, ch := range []<-chan Message{all, byName, byData} {
+		select {
+		case _, ok := <-ch:
+			for ok {
+				_, ok = <-ch
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscription not closed after cancel")
+		}
+	}
+}
+
+func TestMonitorEvents(t *testing.T) {
+	const (
+		shutdown = `{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}, "timestamp": {"seconds": 1700000000, "microseconds": 250}}`
+		resume   = `{"event": "RESUME", "timestamp": {"seconds": 1700000001, "microseconds": 0}}`
+	)
+	listener, port := listenTCP(t)
+	acceptOne(listener, func(req client.Request) string {
+		if req.Execute == "emit" {
+			return eventReply(req, shutdown, resume)
+		}
+		return okReply(req)
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddTCP("vm", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	type shutdownArg struct {
+		Guest  bool   `json:"guest"`
+		Reason string `json:"reason"`
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	shutdowns := Events[shutdownArg](ctx, mon, "vm", "SHUTDOWN")
+	resumes := Events[client.QEmpty](ctx, mon, "", "RESUME")
+
+	if _, err := mon.ExecuteContext(t.Context(), "vm", client.Request{Execute: "emit"}); err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+
+	select {
+	case ev := <-shutdowns:
+		want := client.TimedEvent[shutdownArg]{
+			Instance: "vm",
+			Time:     time.Unix(1700000000, 250000),
+			Data:     shutdownArg{Guest: true, Reason: "guest-shutdown"},
+		}
+		if !ev.Time.Equal(want.Time) || ev.Instance != want.Instance || ev.Data != want.Data {
+			t.Errorf("SHUTDOWN = %+v, want %+v", ev, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for SHUTDOWN")
+	}
+	select {
+	case ev := <-resumes:
+		if ev.Instance != "vm" || !ev.Time.Equal(time.Unix(1700000001, 0)) {
+			t.Errorf("RESUME = %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for RESUME")
+	}
+
+	cancel()
+	for range shutdowns {
+	}
+}
+
+func TestMonitorCountsDroppedMessages(t *testing.T) {
+	const stop = `{"event": "STOP", "data": {}, "timestamp": {"seconds": 1700000000, "microseconds": 3}}`
+	listener, port := listenTCP(t)
+	acceptOne(listener, func(req client.Request) string {
+		if req.Execute == "emit" {
+			return eventReply(req, stop, stop, stop)
+		}
+		return okReply(req)
+	})
+
+	mon, monErr := NewMonitor(WithBufferSize(1), WithDeliveryPolicy(DeliverDropNewest))
+	if monErr != nil {
+		t.Fatalf("NewMonitor: %v", monErr)
+	}
+	defer mon.Close()
+
+	if err := waitAdd(t, mon.AddTCP("tcp-instance", client.TCPConfig{Host: "127.0.0.1", Port: port})); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+	// Messages() is never read, so everything past the first message is dropped
+	stops := mon.Subscribe(t.Context(), EventFilter{Events: []string{"STOP"}})
+	if _, err := mon.ExecuteContext(t.Context(), "tcp-instance", client.Request{Execute: "emit"}); err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+	receiveEvents(t, stops, 1)
+
+	if dropped := mon.Dropped("tcp-instance"); dropped == 0 {
+		t.Error("no dropped messages counted")
+	}
+}
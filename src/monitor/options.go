@@ -0,0 +1,103 @@
+package monitor
+
+import "time"
+
+const (
+	cDefaultNegotiationTimeout = 10 * time.Second
+	cDefaultBufferSize         = 100
+)
+
+type monitorOptions struct {
+	bufferSize      int
+	policy          DeliveryPolicy
+	writeQueueDepth int
+}
+
+// Option customizes a Monitor created with NewMonitor.
+type Option func(*monitorOptions)
+
+// WithBufferSize sets the buffer size of the Messages() channel and of every
+// subscription channel.
+func WithBufferSize(size int) Option {
+	return func(o *monitorOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithDeliveryPolicy sets what happens to messages when a consumer lags behind.
+// The default is DeliverDropNewest.
+func WithDeliveryPolicy(policy DeliveryPolicy) Option {
+	return func(o *monitorOptions) {
+		o.policy = policy
+	}
+}
+
+// WithWriteQueueDepth sets how many requests may wait to be written to a connection
+// that is slow to drain. Once it is reached, Execute waits for room and
+// ExecuteContext gives up when its context ends. The default is 100.
+func WithWriteQueueDepth(depth int) Option {
+	return func(o *monitorOptions) {
+		o.writeQueueDepth = depth
+	}
+}
+
+func newMonitorOptions(opts []Option) monitorOptions {
+	options := monitorOptions{
+		bufferSize: cDefaultBufferSize,
+		policy:     DeliverDropNewest,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.bufferSize < 0 {
+		options.bufferSize = 0
+	}
+	return options
+}
+
+type addOptions struct {
+	capabilities       []string
+	capabilitiesSet    bool
+	negotiationTimeout time.Duration
+	reconnect          *ReconnectPolicy
+	protocol           Protocol
+}
+
+// AddOption customizes how an instance is attached to the Monitor.
+type AddOption func(*addOptions)
+
+// WithCapabilities lists the QMP capabilities (e.g. "oob") enabled with qmp_capabilities
+// once the greeting has been received. Without it, oob is enabled whenever the
+// greeting offers it; pass no capabilities to opt out.
+func WithCapabilities(capabilities ...string) AddOption {
+	return func(o *addOptions) {
+		o.capabilities = capabilities
+		o.capabilitiesSet = true
+	}
+}
+
+// WithNegotiationTimeout bounds the time between establishing the connection and
+// the instance entering command mode.
+func WithNegotiationTimeout(timeout time.Duration) AddOption {
+	return func(o *addOptions) {
+		o.negotiationTimeout = timeout
+	}
+}
+
+// WithReconnect re-establishes the connection according to policy when it drops,
+// instead of removing the instance.
+func WithReconnect(policy ReconnectPolicy) AddOption {
+	return func(o *addOptions) {
+		o.reconnect = &policy
+	}
+}
+
+func newAddOptions(opts []AddOption) addOptions {
+	options := addOptions{
+		negotiationTimeout: cDefaultNegotiationTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+var ErrProcessExited = fmt.Errorf("process exited")
+
+// AddProcess starts cmd, typically QEMU with -qmp stdio, and talks QMP over its
+// stdin and stdout, which must not be set. The instance lives as long as the
+// process: once it exits, the instance is removed and InstanceMessageDelete carries
+// ErrProcessExited, wrapping the *exec.ExitError of an unsuccessful exit. Removing
+// the instance, or closing the Monitor, kills the process. WithReconnect does not
+// apply, since a process cannot be started twice.
+func (m *Monitor) AddProcess(name string, cmd *exec.Cmd, opts ...AddOption) <-chan error {
+	options := newAddOptions(opts)
+	options.reconnect = nil
+	config := &client.ProcessConfig{
+		Cmd: cmd,
+	}
+	inst := newInstance(name, client.CommunicationConfig{
+		Type:    client.Process,
+		Process: config,
+	}, options)
+	config.Started = func(process *os.Process) {
+		m.recordProcess(inst, process)
+	}
+	return m.addInstance(inst)
+}
+
+// recordProcess sets the instance's process as soon as it is started, before its
+// pipes are attached to the queue, so that a failed negotiation or a Remove can
+// kill it. The process is killed right away if the instance is already gone.
+func (m *Monitor) recordProcess(inst *instance, process *os.Process) {
+	m.mu.Lock()
+	inst.process = process
+	current := m.instances[inst.name] == inst
+	m.mu.Unlock()
+
+	if !current {
+		_ = process.Kill()
+	}
+}
+
+// trackProcess waits for the instance's process to exit, if it was started.
+func (m *Monitor) trackProcess(inst *instance, cmd *exec.Cmd) {
+	m.mu.Lock()
+	started := inst.process != nil
+	m.mu.Unlock()
+
+	if started {
+		go m.waitProcess(inst, cmd)
+	}
+}
+
+func (m *Monitor) waitProcess(inst *instance, cmd *exec.Cmd) {
+	err := ErrProcessExited
+	if waitErr := cmd.Wait(); waitErr != nil {
+		err = fmt.Errorf("%w: %w", ErrProcessExited, waitErr)
+	}
+
+	m.mu.Lock()
+	current := m.instances[inst.name] == inst
+	ready := inst.ready
+	hungUp := inst.hungUp
+	if current {
+		delete(m.instances, inst.name)
+	}
+	m.mu.Unlock()
+
+	if !current && !hungUp {
+		// removed by Remove or a failed negotiation, which reported it
+		return
+	}
+	if current {
+		m.queue.Remove(inst.name)
+	}
+	if !ready {
+		m.addLoop.Post(client.Data[error]{
+			Id:      inst.name,
+			Payload: err,
+		})
+	}
+	m.emit(MonitorEvent{
+		InstanceMessage: &InstanceMessage{
+			Instance:            inst.name,
+			InstanceMessageType: InstanceMessageDelete,
+			Error:               err,
+		},
+	})
+}
+
+// killProcess kills the process the instance was started with, if any.
+func (m *Monitor) killProcess(inst *instance) {
+	m.mu.Lock()
+	process := inst.process
+	m.mu.Unlock()
+
+	if process != nil {
+		_ = process.Kill()
+	}
+}
+
+// processes returns the processes of all instances started with AddProcess.
+func (m *Monitor) processes() []*os.Process {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var processes []*os.Process
+	for _, inst := range m.instances {
+		if inst.process != nil {
+			processes = append(processes, inst.process)
+		}
+	}
+	return processes
+}
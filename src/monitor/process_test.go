@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+const cFakeQMPEnv = "QAPI_CLIENT_FAKE_QMP"
+
+// TestMain lets the test binary play QEMU run with -qmp stdio.
+func TestMain(m *testing.M) {
+	if os.Getenv(cFakeQMPEnv) != "" {
+		fakeQMP()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// fakeQMP answers requests on stdin until it gets quit, which makes it exit with
+// status 3 after replying, or close-stdout, which makes it hang up but keep
+// running. Like QEMU, it keeps running when stdin is closed.
+func fakeQMP() {
+	fmt.Fprintf(os.Stdout, "%s\r\n", testGreeting)
+	decoder := json.NewDecoder(os.Stdin)
+	for {
+		var req client.Request
+		if err := decoder.Decode(&req); err != nil {
+			time.Sleep(time.Minute)
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stdout, "%s\r\n", okReply(req))
+		switch req.Execute {
+		case "quit":
+			os.Exit(3)
+		case "close-stdout":
+			os.Stdout.Close()
+		}
+	}
+}
+
+func fakeQMPCommand() *exec.Cmd {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), cFakeQMPEnv+"=1")
+	return cmd
+}
+
+func TestMonitorAddProcess(t *testing.T) {
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.AddProcess("process", fakeQMPCommand())); err != nil {
+		t.Fatalf("AddProcess: %v", err)
+	}
+	if _, err := mon.ExecuteContext(t.Context(), "process", client.Request{Execute: "query-status"}); err != nil {
+		t.Fatalf("ExecuteContext: %v", err)
+	}
+
+	if _, err := mon.ExecuteContext(t.Context(), "process", client.Request{Execute: "quit"}); err != nil {
+		t.Fatalf("quit: %v", err)
+	}
+	ev := waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == "process" &&
+			ev.InstanceMessage.InstanceMessageType == InstanceMessageDelete
+	})
+	var exitErr *exec.ExitError
+	if err := ev.InstanceMessage.Error; !errors.Is(err, ErrProcessExited) || !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("Delete error = %v, want ErrProcessExited with exit status 3", err)
+	}
+	if _, err := mon.ExecuteContext(t.Context(), "process", client.Request{Execute: "query-status"}); err == nil {
+		t.Fatal("instance still usable after the process exited")
+	}
+}
+
+func TestMonitorProcessHangUp(t *testing.T) {
+	mon := newTestMonitor(t)
+	cmd := fakeQMPCommand()
+	if err := waitAdd(t, mon.AddProcess("process", cmd)); err != nil {
+		t.Fatalf("AddProcess: %v", err)
+	}
+	if _, err := mon.ExecuteContext(t.Context(), "process", client.Request{Execute: "close-stdout"}); err != nil {
+		t.Fatalf("close-stdout: %v", err)
+	}
+
+	ev := waitMessage(t, mon.Messages(), func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == "process" &&
+			ev.InstanceMessage.InstanceMessageType == InstanceMessageDelete
+	})
+	var exitErr *exec.ExitError
+	if err := ev.InstanceMessage.Error; !errors.Is(err, ErrProcessExited) || !errors.As(err, &exitErr) {
+		t.Fatalf("Delete error = %v, want ErrProcessExited with the exit status", err)
+	}
+	if !errors.Is(cmd.Process.Signal(syscall.Signal(0)), os.ErrProcessDone) {
+		t.Error("process still running after it hung up")
+	}
+}
+
+func TestMonitorRemoveKillsProcess(t *testing.T) {
+	mon := newTestMonitor(t)
+	cmd := fakeQMPCommand()
+	// the child holds the only write end of stderr, so reading it ends once it exits
+	stderr, childStderr, pipeErr := os.Pipe()
+	if pipeErr != nil {
+		t.Fatal(pipeErr)
+	}
+	defer stderr.Close()
+	cmd.Stderr = childStderr
+	addErr := waitAdd(t, mon.AddProcess("process", cmd))
+	childStderr.Close()
+	if addErr != nil {
+		t.Fatalf("AddProcess: %v", addErr)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, stderr)
+		close(exited)
+	}()
+	if err := waitAdd(t, mon.Remove("process")); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process still running after Remove")
+	}
+}
@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// Protocol selects how a connection enters command mode.
+type Protocol int
+
+const (
+	// ProtocolQMP waits for the QMP greeting and negotiates capabilities.
+	ProtocolQMP Protocol = iota
+	// ProtocolQGA talks to a QEMU Guest Agent: there is no greeting, instead the
+	// connection is synchronized with guest-sync-delimited.
+	ProtocolQGA
+)
+
+var ErrSyncFailed = fmt.Errorf("guest agent synchronization failed")
+var ErrResynchronized = fmt.Errorf("guest agent connection resynchronized")
+
+// WithProtocol sets the protocol spoken on the connection, ProtocolQMP by default.
+func WithProtocol(protocol Protocol) AddOption {
+	return func(o *addOptions) {
+		o.protocol = protocol
+	}
+}
+
+// syncAgent flushes the guest agent's parser and discards whatever a previous,
+// possibly abandoned, exchange left on the connection.
+func (m *Monitor) syncAgent(ctx context.Context, inst *instance) error {
+	syncId := rand.Int64N(1 << 31)
+	arguments, argumentsErr := json.Marshal(struct {
+		Id int64 `json:"id"`
+	}{
+		Id: syncId,
+	})
+	if argumentsErr != nil {
+		return argumentsErr
+	}
+
+	request := client.Request{
+		Id:        client.GenerateId(),
+		Execute:   "guest-sync-delimited",
+		Arguments: arguments,
+	}
+	ch := m.executor.Enqueue(inst.name, request.Id)
+	if err := m.queue.Resync(inst.name, request); err != nil {
+		m.executor.CancelRequest(request.Id, err)
+		return err
+	}
+
+	result, resultErr := NewExecuteResult(ch, inst.name).Get(ctx, 0)
+	if resultErr != nil {
+		if ctx.Err() != nil {
+			m.executor.CancelRequest(request.Id, ctx.Err())
+		}
+		return fmt.Errorf("%w: %w", ErrSyncFailed, resultErr)
+	}
+
+	var echoed int64
+	if err := json.Unmarshal(result.Return, &echoed); err != nil || echoed != syncId {
+		return fmt.Errorf("%w: unexpected reply %s", ErrSyncFailed, result.Return)
+	}
+	return nil
+}
+
+// resync re-synchronizes a guest agent connection after a request timed out, so
+// that its late reply cannot be mistaken for the reply to a later request. Replies
+// ahead of the sentinel are discarded, so the requests still pending afterwards
+// fail with ErrResynchronized rather than wait forever; a request sent meanwhile
+// may fail although its reply would have made it.
+func (m *Monitor) resync(inst *instance) {
+	m.mu.Lock()
+	if m.instances[inst.name] != inst || !inst.ready || inst.syncing {
+		m.mu.Unlock()
+		return
+	}
+	inst.syncing = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		inst.syncing = false
+		m.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), inst.options.negotiationTimeout)
+	defer cancel()
+	if err := m.syncAgent(ctx, inst); err != nil {
+		slog.Error("guest agent resync failed", "instance", inst.name, "error", err)
+	}
+	m.executor.Cancel(inst.name, fmt.Errorf("%w: %w", client.ErrRequestCanceled, ErrResynchronized))
+}
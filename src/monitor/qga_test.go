@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// sentinelFilter drops the 0xFF bytes a client sends to flush the agent's parser.
+type sentinelFilter struct {
+	r *bufio.Reader
+}
+
+func (f sentinelFilter) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && f.r.Buffered() == 0 {
+			break
+		}
+		b, err := f.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b != 0xFF {
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// serveQGA plays a guest agent: guest-sync-delimited replies are preceded by junk
+// and the sentinel, "hang" is never answered, anything else is acknowledged.
+func serveQGA(conn net.Conn, syncs chan<- int64) {
+	defer conn.Close()
+	decoder := json.NewDecoder(sentinelFilter{r: bufio.NewReader(conn)})
+	for {
+		var req client.Request
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+		var reply string
+		switch req.Execute {
+		case "guest-sync-delimited":
+			var args struct {
+				Id int64 `json:"id"`
+			}
+			_ = json.Unmarshal(req.Arguments, &args)
+			syncs <- args.Id
+			reply = fmt.Sprintf(`{"return": {}, "id": "stale"} {"ret`+"\xff"+`{"return": %d, "id": %q}`, args.Id, req.Id)
+		case "hang":
+			continue
+		default:
+			reply = okReply(req)
+		}
+		if _, err := io.WriteString(conn, reply+"\n"); err != nil {
+			return
+		}
+	}
+}
+
+func listenAgent(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	// t.TempDir() may exceed the length limit of Unix socket paths
+	dir, dirErr := os.MkdirTemp("", "qga")
+	if dirErr != nil {
+		t.Fatalf("MkdirTemp: %v", dirErr)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "qga.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		serve(conn)
+	}()
+	return path
+}
+
+func waitSync(t *testing.T, syncs <-chan int64) {
+	t.Helper()
+	select {
+	case <-syncs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for guest-sync-delimited")
+	}
+}
+
+func TestMonitorQGA(t *testing.T) {
+	syncs := make(chan int64, 10)
+	path := listenAgent(t, func(conn net.Conn) {
+		serveQGA(conn, syncs)
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.Add("agent", path, WithProtocol(ProtocolQGA))); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	waitSync(t, syncs)
+
+	if _, ok := mon.Greeting("agent"); ok {
+		t.Error("guest agent recorded a greeting")
+	}
+	if _, err := mon.ExecuteContext(t.Context(), "agent", client.Request{Execute: "guest-ping"}); err != nil {
+		t.Fatalf("guest-ping: %v", err)
+	}
+
+	pending, pendingErr := mon.Execute("agent", client.Request{Id: client.GenerateId(), Execute: "hang"})
+	if pendingErr != nil {
+		t.Fatalf("Execute: %v", pendingErr)
+	}
+	result, executeErr := mon.Execute("agent", client.Request{Id: client.GenerateId(), Execute: "hang"})
+	if executeErr != nil {
+		t.Fatalf("Execute: %v", executeErr)
+	}
+	if _, err := result.Get(t.Context(), 50*time.Millisecond); !errors.Is(err, client.ErrTimeout) {
+		t.Fatalf("hang error = %v, want %v", err, client.ErrTimeout)
+	}
+	// the timeout re-synchronizes the connection
+	waitSync(t, syncs)
+	for _, res := range []*ExecuteResult{pending, result} {
+		if _, err := res.Get(t.Context(), 5*time.Second); !errors.Is(err, ErrResynchronized) || !errors.Is(err, client.ErrRequestCanceled) {
+			t.Errorf("request pending across the resync: %v, want %v", err, ErrResynchronized)
+		}
+	}
+
+	if _, err := mon.ExecuteContext(t.Context(), "agent", client.Request{Execute: "guest-ping"}); err != nil {
+		t.Fatalf("guest-ping after resync: %v", err)
+	}
+}
+
+func TestMonitorQGASyncMismatch(t *testing.T) {
+	path := listenAgent(t, func(conn net.Conn) {
+		defer conn.Close()
+		decoder := json.NewDecoder(sentinelFilter{r: bufio.NewReader(conn)})
+		var req client.Request
+		if decoder.Decode(&req) == nil {
+			fmt.Fprintf(conn, "\xff{\"return\": -1, \"id\": %q}\n", req.Id)
+		}
+		_, _ = conn.Read(make([]byte, 1))
+	})
+
+	mon := newTestMonitor(t)
+	if err := waitAdd(t, mon.Add("agent", path, WithProtocol(ProtocolQGA))); !errors.Is(err, ErrSyncFailed) {
+		t.Fatalf("Add error = %v, want %v", err, ErrSyncFailed)
+	}
+}
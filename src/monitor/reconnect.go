@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	cDefaultReconnectInitialDelay = 500 * time.Millisecond
+	cDefaultReconnectMaxDelay     = 30 * time.Second
+	cDefaultReconnectMultiplier   = 2
+)
+
+// ReconnectPolicy describes how a dropped connection is re-established: the delay
+// between attempts starts at InitialDelay and grows by Multiplier up to MaxDelay,
+// each delay randomized by ±Jitter (a fraction, e.g. 0.2). Zero values fall back
+// to defaults; a zero MaxAttempts retries until the instance is removed.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxAttempts  int
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = cDefaultReconnectInitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = cDefaultReconnectMaxDelay
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = cDefaultReconnectMultiplier
+	}
+	p.Jitter = min(max(p.Jitter, 0), 1)
+	return p
+}
+
+// delay returns the randomized wait before the given attempt, counting from 1.
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempt && delay < float64(p.MaxDelay); i++ {
+		delay *= p.Multiplier
+	}
+	delay = min(delay, float64(p.MaxDelay))
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// reconnect applies the instance's ReconnectPolicy until a connection is established
+// and negotiated, the attempts are exhausted or the instance goes away.
+func (m *Monitor) reconnect(inst *instance) {
+	policy := inst.options.reconnect.withDefaults()
+
+	var err error
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-m.doneCh:
+			timer.Stop()
+			return
+		}
+
+		m.mu.Lock()
+		if m.instances[inst.name] != inst {
+			m.mu.Unlock()
+			return
+		}
+		inst.reset()
+		m.mu.Unlock()
+
+		select {
+		case err = <-m.connect(inst):
+		case <-m.doneCh:
+			return
+		}
+		if err == nil {
+			// negotiate reported InstanceMessageReconnected
+			return
+		}
+		slog.Info("reconnect attempt failed", "instance", inst.name, "attempt", attempt, "error", err)
+	}
+
+	m.dropInstance(inst.name)
+	m.emit(MonitorEvent{
+		InstanceMessage: &InstanceMessage{
+			Instance:            inst.name,
+			InstanceMessageType: InstanceMessageDelete,
+			Error:               err,
+		},
+	})
+}
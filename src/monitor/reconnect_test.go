@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   3,
+	}.withDefaults()
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 300 * time.Millisecond},
+		{3, 900 * time.Millisecond},
+		{4, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for range 100 {
+		if got := policy.delay(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("delay(1) with jitter = %v, want within [50ms, 150ms]", got)
+		}
+	}
+}
+
+// quitReply hangs up on "quit" and acknowledges everything else.
+func quitReply(req client.Request) string {
+	if req.Execute == "quit" {
+		return closeConnection
+	}
+	return okReply(req)
+}
+
+func instanceMessage(name string, kind InstanceMessageType) func(MonitorEvent) bool {
+	return func(ev MonitorEvent) bool {
+		return ev.InstanceMessage != nil &&
+			ev.InstanceMessage.Instance == name &&
+			ev.InstanceMessage.InstanceMessageType == kind
+	}
+}
+
+func TestMonitorReconnect(t *testing.T) {
+	listener, port := listenTCP(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveQMP(conn, quitReply)
+		}
+	}()
+
+	mon := newTestMonitor(t)
+	config := client.TCPConfig{Host: "127.0.0.1", Port: port, DialTimeout: time.Second}
+	if err := waitAdd(t, mon.AddTCP("vm", config, WithReconnect(ReconnectPolicy{InitialDelay: 10 * time.Millisecond}))); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+	waitMessage(t, mon.Messages(), instanceMessage("vm", InstanceMessageAdd))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// a reconnected instance reconnects again when it drops once more
+	for range 2 {
+		if _, err := mon.ExecuteContext(ctx, "vm", client.Request{Execute: "quit"}); !errors.Is(err, client.ErrDisconnected) {
+			t.Fatalf("quit error = %v, want ErrDisconnected", err)
+		}
+
+		ev := waitMessage(t, mon.Messages(), instanceMessage("vm", InstanceMessageReconnecting))
+		if ev.InstanceMessage.Error == nil {
+			t.Error("Reconnecting message carries no error")
+		}
+		waitMessage(t, mon.Messages(), instanceMessage("vm", InstanceMessageReconnected))
+	}
+
+	if _, ok := mon.Greeting("vm"); !ok {
+		t.Error("greeting not recorded after reconnect")
+	}
+	if _, err := mon.ExecuteContext(ctx, "vm", client.Request{Execute: "query-status"}); err != nil {
+		t.Fatalf("query-status after reconnect: %v", err)
+	}
+}
+
+func TestMonitorReconnectGivesUp(t *testing.T) {
+	listener, port := listenTCP(t)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// nothing accepts the reconnect attempts
+		listener.Close()
+		serveQMP(conn, quitReply)
+	}()
+
+	mon := newTestMonitor(t)
+	config := client.TCPConfig{Host: "127.0.0.1", Port: port, DialTimeout: time.Second}
+	policy := ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxAttempts: 2}
+	if err := waitAdd(t, mon.AddTCP("vm", config, WithReconnect(policy))); err != nil {
+		t.Fatalf("AddTCP: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mon.ExecuteContext(ctx, "vm", client.Request{Execute: "quit"})
+
+	waitMessage(t, mon.Messages(), instanceMessage("vm", InstanceMessageReconnecting))
+	ev := waitMessage(t, mon.Messages(), instanceMessage("vm", InstanceMessageDelete))
+	if ev.InstanceMessage.Error == nil {
+		t.Error("Delete message carries no error")
+	}
+	if _, err := mon.ExecuteContext(ctx, "vm", client.Request{Execute: "query-status"}); !errors.Is(err, client.ErrDisconnected) {
+		t.Errorf("query-status error = %v, want ErrDisconnected", err)
+	}
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/q-controller/qapi-client/src/client"
+)
+
+// EventFilter selects the events delivered to a subscriber. Every non-empty
+// criterion has to match; a zero EventFilter matches all events.
+type EventFilter struct {
+	// Instances the event must come from
+	Instances []string
+	// Events lists accepted event names, e.g. "SHUTDOWN" or "BLOCK_JOB_COMPLETED"
+	Events []string
+	// Match is an additional predicate, typically inspecting event.Data
+	Match func(instance string, event *client.QAPIEvent) bool
+}
+
+func (f *EventFilter) matches(msg *Message) bool {
+	if msg.Event == nil {
+		return false
+	}
+	if len(f.Instances) > 0 && !slices.Contains(f.Instances, msg.Instance) {
+		return false
+	}
+	if len(f.Events) > 0 && !slices.Contains(f.Events, msg.Event.Event) {
+		return false
+	}
+	if f.Match != nil && !f.Match(msg.Instance, msg.Event) {
+		return false
+	}
+	return true
+}
+
+type subscriber struct {
+	filter EventFilter
+	box    *outbox[Message]
+}
+
+// Subscribe returns a channel receiving the events that match filter. Delivery
+// follows the Monitor's DeliveryPolicy and buffer size. Every
+// subscriber gets its own copy of each matching event, independently of
+// Messages() and of other subscribers. The channel is closed once ctx is done
+// or the Monitor is closed.
+func (m *Monitor) Subscribe(ctx context.Context, filter EventFilter) <-chan Message {
+	sub := &subscriber{
+		filter: filter,
+		box: newOutbox(m.options.bufferSize, m.options.policy, func(msg Message) {
+			m.countDropped(msg.Instance)
+		}),
+	}
+
+	m.subMu.Lock()
+	m.subscribers[sub] = struct{}{}
+	m.subMu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-m.doneCh:
+		}
+
+		// Closing first unblocks a publish waiting on this subscriber
+		sub.box.close()
+		m.subMu.Lock()
+		delete(m.subscribers, sub)
+		m.subMu.Unlock()
+	}()
+
+	return sub.box.ch
+}
+
+// publish hands an event over to every subscriber whose filter matches it.
+func (m *Monitor) publish(msg Message) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for sub := range m.subscribers {
+		if sub.filter.matches(&msg) {
+			sub.box.deliver(msg)
+		}
+	}
+}
+
+// Events subscribes to the events called event of the instance (of all instances
+// if instance is empty) and decodes their data into T. Events whose data does not
+// decode are logged and skipped. Generated On<Event> helpers are built on it.
+func Events[T any](ctx context.Context, m *Monitor, instance, event string) <-chan client.TimedEvent[T] {
+	filter := EventFilter{
+		Events: []string{event},
+	}
+	if instance != "" {
+		filter.Instances = []string{instance}
+	}
+	messages := m.Subscribe(ctx, filter)
+
+	ch := make(chan client.TimedEvent[T])
+	go func() {
+		defer close(ch)
+		for msg := range messages {
+			ev := client.TimedEvent[T]{
+				Instance: msg.Instance,
+				Time:     msg.Event.Time(),
+			}
+			if len(msg.Event.Data) > 0 {
+				if err := json.Unmarshal(msg.Event.Data, &ev.Data); err != nil {
+					slog.Error("Failed to decode event data", "event", event, "instance", msg.Instance, "error", err)
+					continue
+				}
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"sync"
+)
+
+// Sentinel is the byte QEMU Guest Agent uses to delimit guest-sync-delimited
+// replies; it never occurs in valid UTF-8 JSON.
+const Sentinel = 0xFF
+
+const (
+	cInitialBufferSize = 4096
+	// buffers grown beyond this, e.g. by a query-qmp-schema reply, are not pooled
+	cMaxPooledBufferSize = 1 << 20
+)
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, cInitialBufferSize)
+		return &buf
+	},
+}
+
+// GetBuffer returns an empty buffer from the pool shared with Framer.
+func GetBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// PutBuffer hands buf back to the pool.
+func PutBuffer(buf *[]byte) {
+	if cap(*buf) > cMaxPooledBufferSize {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
+
+// Framer splits a stream of JSON objects into messages as it arrives. Unlike
+// ParseJSONObjects it keeps the nesting and string state between calls to Feed,
+// so every byte is scanned once however the stream is chunked.
+//
+// Only objects and arrays are framed: anything else found between messages is
+// skipped. A 0xFF sentinel drops the message in progress. The zero Framer is
+// ready to use.
+type Framer struct {
+	// buf holds an incomplete message, nil while there is none
+	buf      *[]byte
+	scanned  int
+	depth    int
+	inString bool
+	escaped  bool
+	resync   bool
+}
+
+// Resync drops the message in progress and makes Feed discard data up to and
+// including the next 0xFF sentinel.
+func (f *Framer) Resync() {
+	f.Reset()
+	f.resync = true
+}
+
+// Reset drops the message in progress.
+func (f *Framer) Reset() {
+	f.release()
+	f.depth = 0
+	f.inString = false
+	f.escaped = false
+	f.resync = false
+}
+
+// Buffered returns the size of the incomplete message held by the Framer.
+func (f *Framer) Buffered() int {
+	if f.buf == nil {
+		return 0
+	}
+	return len(*f.buf)
+}
+
+// Feed scans data and returns the messages it completes. The messages share one
+// freshly allocated backing array; data is not retained.
+func (f *Framer) Feed(data []byte) [][]byte {
+	src := data
+	if f.buf != nil {
+		*f.buf = append(*f.buf, data...)
+		src = *f.buf
+	}
+
+	// bounds of the complete messages; start is where the one in progress begins
+	var bounds []int
+	start := 0
+	i := f.scanned
+	for ; i < len(src); i++ {
+		c := src[i]
+		if c == Sentinel {
+			f.resync = false
+			f.depth = 0
+			f.inString = false
+			f.escaped = false
+			continue
+		}
+		if f.resync {
+			continue
+		}
+
+		if f.depth == 0 {
+			if c == '{' || c == '[' {
+				f.depth = 1
+				start = i
+			}
+			continue
+		}
+
+		if f.inString {
+			switch {
+			case f.escaped:
+				f.escaped = false
+			case c == '\\':
+				f.escaped = true
+			case c == '"':
+				f.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			f.inString = true
+		case '{', '[':
+			f.depth++
+		case '}', ']':
+			f.depth--
+			if f.depth == 0 {
+				bounds = append(bounds, start, i+1)
+			}
+		}
+	}
+
+	messages := f.collect(src, bounds)
+	f.keep(src, start)
+	return messages
+}
+
+// collect copies the messages delimited by bounds out of src.
+func (f *Framer) collect(src []byte, bounds []int) [][]byte {
+	if len(bounds) == 0 {
+		return nil
+	}
+
+	size := 0
+	for i := 0; i < len(bounds); i += 2 {
+		size += bounds[i+1] - bounds[i]
+	}
+	backing := make([]byte, 0, size)
+	messages := make([][]byte, 0, len(bounds)/2)
+	for i := 0; i < len(bounds); i += 2 {
+		offset := len(backing)
+		backing = append(backing, src[bounds[i]:bounds[i+1]]...)
+		messages = append(messages, backing[offset:len(backing):len(backing)])
+	}
+	return messages
+}
+
+// keep holds on to the message in progress, which begins at start.
+func (f *Framer) keep(src []byte, start int) {
+	if f.depth == 0 {
+		f.release()
+		return
+	}
+
+	pending := src[start:]
+	if f.buf == nil {
+		f.buf = GetBuffer()
+		*f.buf = append(*f.buf, pending...)
+	} else if start > 0 {
+		*f.buf = (*f.buf)[:copy(*f.buf, pending)]
+	}
+	f.scanned = len(pending)
+}
+
+func (f *Framer) release() {
+	if f.buf != nil {
+		PutBuffer(f.buf)
+		f.buf = nil
+	}
+	f.scanned = 0
+}
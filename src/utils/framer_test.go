@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func feedChunks(f *Framer, input []byte, chunkSize int) []string {
+	got := []string{}
+	for len(input) > 0 {
+		n := min(chunkSize, len(input))
+		for _, msg := range f.Feed(input[:n]) {
+			got = append(got, string(msg))
+		}
+		input = input[n:]
+	}
+	return got
+}
+
+func TestFramer(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		resync       bool
+		wantMessages []string
+		wantBuffered bool
+	}{
+		{
+			name:         "Single complete object",
+			input:        `{"key": "value"}`,
+			wantMessages: []string{`{"key": "value"}`},
+		},
+		{
+			name:         "Multiple objects separated by CRLF",
+			input:        "{\"key1\": \"value1\"}\r\n{\"key2\": \"value2\"}\r\n",
+			wantMessages: []string{`{"key1": "value1"}`, `{"key2": "value2"}`},
+		},
+		{
+			name:         "Complete object followed by incomplete",
+			input:        `{"key1": "value1"} {"key2": "val`,
+			wantMessages: []string{`{"key1": "value1"}`},
+			wantBuffered: true,
+		},
+		{
+			name:         "Object with nested braces and arrays",
+			input:        `{"outer": {"inner": [1, {"x": []}]}}`,
+			wantMessages: []string{`{"outer": {"inner": [1, {"x": []}]}}`},
+		},
+		{
+			name:         "Object with braces in string",
+			input:        `{"key": "value with { and ] inside"}`,
+			wantMessages: []string{`{"key": "value with { and ] inside"}`},
+		},
+		{
+			name:         "Object with escaped quotes and backslashes",
+			input:        `{"key": "a \"}\" b \\"}{"next": "\\\""}`,
+			wantMessages: []string{`{"key": "a \"}\" b \\"}`, `{"next": "\\\""}`},
+		},
+		{
+			name:         "Garbage between objects is skipped",
+			input:        `{"key1": "value1"} garbage 42 {"key2": "value2"}`,
+			wantMessages: []string{`{"key1": "value1"}`, `{"key2": "value2"}`},
+		},
+		{
+			name:         "Sentinel drops the message in progress",
+			input:        "{\"stale\": \"rep\xff{\"return\": 1}",
+			wantMessages: []string{`{"return": 1}`},
+		},
+		{
+			name:         "Resync discards up to the sentinel",
+			input:        "{\"return\": {}}\r\n\xff{\"return\": 42}",
+			resync:       true,
+			wantMessages: []string{`{"return": 42}`},
+		},
+		{
+			name:         "Resync without sentinel discards everything",
+			input:        `{"return": {}} {"return": {`,
+			resync:       true,
+			wantMessages: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, chunkSize := range []int{1, 2, 3, 7, 1024} {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, chunkSize), func(t *testing.T) {
+				var f Framer
+				if tt.resync {
+					f.Resync()
+				}
+				got := feedChunks(&f, []byte(tt.input), chunkSize)
+				if !reflect.DeepEqual(got, tt.wantMessages) {
+					t.Errorf("Feed() = %q, want %q", got, tt.wantMessages)
+				}
+				if buffered := f.Buffered() > 0; buffered != tt.wantBuffered {
+					t.Errorf("Buffered() = %d, want buffered %v", f.Buffered(), tt.wantBuffered)
+				}
+			})
+		}
+	}
+}
+
+func TestFramerMessagesDoNotAlias(t *testing.T) {
+	var f Framer
+	first := f.Feed([]byte(`{"a": 1}{"b": 2}{"c": `))
+	if len(first) != 2 {
+		t.Fatalf("got %d messages, want 2", len(first))
+	}
+	first[0] = append(first[0], "garbage"...)
+	second := f.Feed([]byte(`3}`))
+
+	if got := string(first[1]); got != `{"b": 2}` {
+		t.Errorf("second message = %q after appending to the first", got)
+	}
+	if len(second) != 1 || string(second[0]) != `{"c": 3}` {
+		t.Errorf("Feed() = %q, want [{\"c\": 3}]", second)
+	}
+}
+
+// decodeAll frames input with encoding/json, reporting false unless input is a
+// sequence of objects and arrays.
+func decodeAll(input []byte) ([]string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	messages := []string{}
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return messages, true
+		} else if err != nil {
+			return nil, false
+		}
+		if raw[0] != '{' && raw[0] != '[' {
+			return nil, false
+		}
+		messages = append(messages, string(raw))
+	}
+}
+
+func FuzzFramer(f *testing.F) {
+	f.Add([]byte(`{"return": {}, "id": "1"}`), uint8(1))
+	f.Add([]byte("{\"event\": \"SHUTDOWN\", \"data\": {\"guest\": true}}\r\n{\"return\": [1, 2]}\r\n"), uint8(5))
+	f.Add([]byte(`{"key": "value with \"}\" inside"} [{"nested": [[]]}]`), uint8(3))
+	f.Add([]byte("\xff{\"return\": 42}"), uint8(2))
+
+	f.Fuzz(func(t *testing.T, input []byte, split uint8) {
+		var whole Framer
+		want := feedChunks(&whole, input, len(input)+1)
+
+		var chunked Framer
+		got := feedChunks(&chunked, input, int(split)+1)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("chunks of %d: %q, at once: %q", int(split)+1, got, want)
+		}
+		if chunked.Buffered() != whole.Buffered() {
+			t.Fatalf("chunks of %d buffered %d, at once %d", int(split)+1, chunked.Buffered(), whole.Buffered())
+		}
+		for _, msg := range got {
+			if first, last := msg[0], msg[len(msg)-1]; (first != '{' && first != '[') || (last != '}' && last != ']') {
+				t.Fatalf("message %q is not an object or array", msg)
+			}
+		}
+
+		if bytes.IndexByte(input, Sentinel) >= 0 {
+			return
+		}
+		if decoded, ok := decodeAll(input); ok && !reflect.DeepEqual(got, decoded) {
+			t.Fatalf("Feed() = %q, encoding/json = %q", got, decoded)
+		}
+	})
+}
+
+// largeReply resembles a query-qmp-schema reply.
+func largeReply(size int) []byte {
+	var sb strings.Builder
+	sb.WriteString(`{"return": [`)
+	for i := 0; sb.Len() < size; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, `{"name": "%d", "meta-type": "object", "members": [{"name": "arg", "type": "str"}]}`, i)
+	}
+	sb.WriteString("]}\r\n")
+	return []byte(sb.String())
+}
+
+const cBenchmarkChunkSize = 1024
+
+func BenchmarkFramer(b *testing.B) {
+	for _, size := range []int{4 << 10, 256 << 10} {
+		reply := largeReply(size)
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(reply)))
+			b.ReportAllocs()
+			var f Framer
+			for b.Loop() {
+				if n := len(feedChunks(&f, reply, cBenchmarkChunkSize)); n != 1 {
+					b.Fatalf("got %d messages, want 1", n)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParseJSONObjects re-parses the buffer on every chunk, the way readers
+// used ParseJSONObjects.
+func BenchmarkParseJSONObjects(b *testing.B) {
+	for _, size := range []int{4 << 10, 256 << 10} {
+		reply := largeReply(size)
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(reply)))
+			b.ReportAllocs()
+			for b.Loop() {
+				var buffer strings.Builder
+				count := 0
+				for input := reply; len(input) > 0; {
+					n := min(cBenchmarkChunkSize, len(input))
+					buffer.Write(input[:n])
+					input = input[n:]
+					objects, remaining, _ := ParseJSONObjects(buffer.String())
+					count += len(objects)
+					buffer.Reset()
+					buffer.WriteString(remaining)
+				}
+				if count != 1 {
+					b.Fatalf("got %d messages, want 1", count)
+				}
+			}
+		})
+	}
+}
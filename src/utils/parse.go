@@ -10,6 +10,7 @@ import (
 // 1. A slice of complete JSON objects
 // 2. Any remaining unparsed data
 // 3. An error if there was a problem parsing
+// It re-parses input from the start on every call; streams are better split with a Framer.
 func ParseJSONObjects(input string) ([]string, string, error) {
 	jsonObjects := []string{}
 